@@ -1,19 +1,32 @@
 package sysmgr_arch
 
 import (
+	"debug/elf"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"strconv"
+	"strings"
 
 	wzlib_logger "github.com/infra-whizz/wzlib/logger"
 )
 
 type Arch struct {
-	Magic  string
-	Mask   string
-	Name   string
-	CPUBit uint8
+	Magic      string      `yaml:"magic"`
+	Mask       string      `yaml:"mask"`
+	Name       string      `yaml:"name"`
+	CPUBit     uint8       `yaml:"bits"`
+	Machine    elf.Machine `yaml:"-"`          // ELF machine
+	Endian     string      `yaml:"endian"`     // "little" or "big"
+	Family     string      `yaml:"family"`     // CPU family, as meson knows it
+	Triplets   []string    `yaml:"triplets"`   // GNU triplets of cross compilers, the preferred first
+	Multiarch  string      `yaml:"multiarch"`  // Debian multiarch library directory
+	DynLinkers []string    `yaml:"dynlinkers"` // Dynamic linker file names, the preferred first
+	Qemu       string      `yaml:"qemu"`       // QEMU user emulator name, as in "qemu-<name>"
+	DpkgArch   string      `yaml:"dpkg"`       // Architecture name for dpkg/apt
+	RpmArch    string      `yaml:"rpm"`        // Architecture name for rpm/zypper/dnf
+	OciArch    string      `yaml:"oci"`        // Architecture name in OCI image platforms
 }
 
 type BinFormat struct {
@@ -24,8 +37,18 @@ type BinFormat struct {
 	Arch_MIPS32 *Arch
 	Arch_MIPS64 *Arch
 
+	Arch_i386        *Arch
+	Arch_ARMEB       *Arch
+	Arch_ARM64BE     *Arch
+	Arch_MIPSEL      *Arch
+	Arch_PPC64LE     *Arch
+	Arch_S390X       *Arch
+	Arch_RISCV64     *Arch
+	Arch_LOONGARCH64 *Arch
+
 	Architectures []*Arch
 	bfmtMisc      string
+	flags         string
 
 	wzlib_logger.WzLogger
 }
@@ -33,45 +56,184 @@ type BinFormat struct {
 func NewBinFormat() *BinFormat {
 	bf := new(BinFormat)
 	bf.Arch_ARM = &Arch{
-		Magic:  `\x7fELF\x01\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x28\x00`,
-		Mask:   `\xff\xff\xff\xff\xff\xff\xff\x00\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff\xff`,
-		Name:   "arm",
-		CPUBit: 32,
+		Magic:      `\x7fELF\x01\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x28\x00`,
+		Mask:       `\xff\xff\xff\xff\xff\xff\xff\x00\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff\xff`,
+		Name:       "arm",
+		CPUBit:     32,
+		Machine:    elf.EM_ARM,
+		Family:     "arm",
+		Triplets:   []string{"arm-linux-gnueabihf", "arm-linux-gnueabi", "armv7hl-suse-linux-gnueabi", "arm-suse-linux-gnueabi"},
+		Multiarch:  "arm-linux-gnueabihf",
+		DynLinkers: []string{"ld-linux-armhf.so.3", "ld-linux.so.3"},
+		DpkgArch:   "armhf",
+		RpmArch:    "armv7hl",
 	}
 
 	bf.Arch_ARM64 = &Arch{
-		Magic:  `\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\xb7\x00`,
-		Mask:   `\xff\xff\xff\xff\xff\xff\xff\x00\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff\xff`,
-		Name:   "aarch64",
-		CPUBit: 64,
+		Magic:      `\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\xb7\x00`,
+		Mask:       `\xff\xff\xff\xff\xff\xff\xff\x00\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff\xff`,
+		Name:       "aarch64",
+		CPUBit:     64,
+		Machine:    elf.EM_AARCH64,
+		Family:     "aarch64",
+		Triplets:   []string{"aarch64-linux-gnu", "aarch64-suse-linux", "aarch64-redhat-linux"},
+		Multiarch:  "aarch64-linux-gnu",
+		DynLinkers: []string{"ld-linux-aarch64.so.1"},
+		DpkgArch:   "arm64",
+		OciArch:    "arm64",
 	}
 
 	bf.Arch_x86_64 = &Arch{
-		Magic:  `\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x3e\x00`,
-		Mask:   `\xff\xff\xff\xff\xff\xfe\xfe\x00\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff\xff`,
-		Name:   "x86_64",
-		CPUBit: 64,
+		Magic:      `\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x3e\x00`,
+		Mask:       `\xff\xff\xff\xff\xff\xfe\xfe\x00\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff\xff`,
+		Name:       "x86_64",
+		CPUBit:     64,
+		Machine:    elf.EM_X86_64,
+		Family:     "x86_64",
+		Triplets:   []string{"x86_64-linux-gnu", "x86_64-suse-linux", "x86_64-redhat-linux"},
+		Multiarch:  "x86_64-linux-gnu",
+		DynLinkers: []string{"ld-linux-x86-64.so.2"},
+		DpkgArch:   "amd64",
+		OciArch:    "amd64",
 	}
 
 	bf.Arch_MIPS = &Arch{
-		Magic:  `\x7fELF\x01\x02\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x08`,
-		Mask:   `\xff\xff\xff\xff\xff\xff\xff\x00\xff\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff`,
-		Name:   "mips",
-		CPUBit: 32,
+		Magic:      `\x7fELF\x01\x02\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x08`,
+		Mask:       `\xff\xff\xff\xff\xff\xff\xff\x00\xff\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff`,
+		Name:       "mips",
+		CPUBit:     32,
+		Machine:    elf.EM_MIPS,
+		Family:     "mips",
+		Triplets:   []string{"mips-linux-gnu", "mips-suse-linux"},
+		Multiarch:  "mips-linux-gnu",
+		DynLinkers: []string{"ld.so.1"},
 	}
 
 	bf.Arch_MIPS32 = &Arch{
-		Magic:  `\x7fELF\x01\x02\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x08`,
-		Mask:   `\xff\xff\xff\xff\xff\xff\xff\x00\xff\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff`,
-		Name:   "mipsn32",
-		CPUBit: 32,
+		Magic:      `\x7fELF\x01\x02\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x08`,
+		Mask:       `\xff\xff\xff\xff\xff\xff\xff\x00\xff\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff`,
+		Name:       "mipsn32",
+		CPUBit:     32,
+		Machine:    elf.EM_MIPS,
+		Family:     "mips64",
+		Triplets:   []string{"mips64-linux-gnuabin32"},
+		Multiarch:  "mips64-linux-gnuabin32",
+		DynLinkers: []string{"ld.so.1"},
+		OciArch:    "mips",
 	}
 
 	bf.Arch_MIPS64 = &Arch{
-		Magic:  `\x7fELF\x02\x02\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x08`,
-		Mask:   `\xff\xff\xff\xff\xff\xff\xff\x00\xff\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff`,
-		Name:   "mips64",
-		CPUBit: 64,
+		Magic:      `\x7fELF\x02\x02\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x08`,
+		Mask:       `\xff\xff\xff\xff\xff\xff\xff\x00\xff\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff`,
+		Name:       "mips64",
+		CPUBit:     64,
+		Machine:    elf.EM_MIPS,
+		Family:     "mips64",
+		Triplets:   []string{"mips64-linux-gnuabi64", "mips64-suse-linux"},
+		Multiarch:  "mips64-linux-gnuabi64",
+		DynLinkers: []string{"ld.so.1"},
+	}
+
+	bf.Arch_i386 = &Arch{
+		Magic:      `\x7fELF\x01\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x03\x00`,
+		Mask:       `\xff\xff\xff\xff\xff\xfe\xfe\x00\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff\xff`,
+		Name:       "i386",
+		CPUBit:     32,
+		Machine:    elf.EM_386,
+		Family:     "x86",
+		Triplets:   []string{"i686-linux-gnu", "i586-suse-linux", "i686-redhat-linux"},
+		Multiarch:  "i386-linux-gnu",
+		DynLinkers: []string{"ld-linux.so.2"},
+		RpmArch:    "i686",
+		OciArch:    "386",
+	}
+
+	bf.Arch_ARMEB = &Arch{
+		Magic:      `\x7fELF\x01\x02\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x28`,
+		Mask:       `\xff\xff\xff\xff\xff\xff\xff\x00\xff\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff`,
+		Name:       "armeb",
+		CPUBit:     32,
+		Machine:    elf.EM_ARM,
+		Family:     "arm",
+		Triplets:   []string{"armeb-linux-gnueabihf", "armeb-linux-gnueabi"},
+		Multiarch:  "armeb-linux-gnueabihf",
+		DynLinkers: []string{"ld-linux-armhf.so.3", "ld-linux.so.3"},
+	}
+
+	bf.Arch_ARM64BE = &Arch{
+		Magic:      `\x7fELF\x02\x02\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\xb7`,
+		Mask:       `\xff\xff\xff\xff\xff\xff\xff\x00\xff\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff`,
+		Name:       "aarch64_be",
+		CPUBit:     64,
+		Machine:    elf.EM_AARCH64,
+		Family:     "aarch64",
+		Triplets:   []string{"aarch64_be-linux-gnu"},
+		Multiarch:  "aarch64_be-linux-gnu",
+		DynLinkers: []string{"ld-linux-aarch64_be.so.1"},
+	}
+
+	bf.Arch_MIPSEL = &Arch{
+		Magic:      `\x7fELF\x01\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x08\x00`,
+		Mask:       `\xff\xff\xff\xff\xff\xff\xff\x00\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff\xff`,
+		Name:       "mipsel",
+		CPUBit:     32,
+		Machine:    elf.EM_MIPS,
+		Family:     "mips",
+		Triplets:   []string{"mipsel-linux-gnu"},
+		Multiarch:  "mipsel-linux-gnu",
+		DynLinkers: []string{"ld.so.1"},
+		OciArch:    "mipsle",
+	}
+
+	bf.Arch_PPC64LE = &Arch{
+		Magic:      `\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x15\x00`,
+		Mask:       `\xff\xff\xff\xff\xff\xff\xff\x00\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff\x00`,
+		Name:       "ppc64le",
+		CPUBit:     64,
+		Machine:    elf.EM_PPC64,
+		Family:     "ppc64",
+		Triplets:   []string{"powerpc64le-linux-gnu", "powerpc64le-suse-linux", "ppc64le-redhat-linux"},
+		Multiarch:  "powerpc64le-linux-gnu",
+		DynLinkers: []string{"ld64.so.2"},
+		DpkgArch:   "ppc64el",
+	}
+
+	bf.Arch_S390X = &Arch{
+		Magic:      `\x7fELF\x02\x02\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x16`,
+		Mask:       `\xff\xff\xff\xff\xff\xff\xff\x00\xff\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff`,
+		Name:       "s390x",
+		CPUBit:     64,
+		Machine:    elf.EM_S390,
+		Family:     "s390x",
+		Triplets:   []string{"s390x-linux-gnu", "s390x-suse-linux", "s390x-redhat-linux"},
+		Multiarch:  "s390x-linux-gnu",
+		DynLinkers: []string{"ld64.so.1"},
+	}
+
+	bf.Arch_RISCV64 = &Arch{
+		Magic:      `\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\xf3\x00`,
+		Mask:       `\xff\xff\xff\xff\xff\xff\xff\x00\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff\xff`,
+		Name:       "riscv64",
+		CPUBit:     64,
+		Machine:    elf.EM_RISCV,
+		Family:     "riscv64",
+		Triplets:   []string{"riscv64-linux-gnu", "riscv64-suse-linux", "riscv64-redhat-linux"},
+		Multiarch:  "riscv64-linux-gnu",
+		DynLinkers: []string{"ld-linux-riscv64-lp64d.so.1"},
+	}
+
+	bf.Arch_LOONGARCH64 = &Arch{
+		Magic:      `\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x02\x01`,
+		Mask:       `\xff\xff\xff\xff\xff\xff\xff\x00\xff\xff\xff\xff\xff\xff\xff\xff\xfe\xff\xff\xff`,
+		Name:       "loongarch64",
+		CPUBit:     64,
+		Machine:    elf.Machine(258), // EM_LOONGARCH, not known to older Go
+		Family:     "loongarch64",
+		Triplets:   []string{"loongarch64-linux-gnu"},
+		Multiarch:  "loongarch64-linux-gnu",
+		DynLinkers: []string{"ld-linux-loongarch-lp64d.so.1"},
+		DpkgArch:   "loong64",
+		OciArch:    "loong64",
 	}
 
 	// Supported architectures
@@ -82,9 +244,18 @@ func NewBinFormat() *BinFormat {
 		bf.Arch_MIPS,
 		bf.Arch_MIPS32,
 		bf.Arch_MIPS64,
+		bf.Arch_i386,
+		bf.Arch_ARMEB,
+		bf.Arch_ARM64BE,
+		bf.Arch_MIPSEL,
+		bf.Arch_PPC64LE,
+		bf.Arch_S390X,
+		bf.Arch_RISCV64,
+		bf.Arch_LOONGARCH64,
 	}
 
 	bf.bfmtMisc = "/proc/sys/fs/binfmt_misc"
+	bf.loadArchitectures(ArchConfigDir)
 
 	return bf
 }
@@ -99,6 +270,79 @@ func (bf BinFormat) GetArch(arch string) (*Arch, error) {
 	return nil, fmt.Errorf("Unknown architecture: %s", arch)
 }
 
+// parseEscaped "\x.." notation of binfmt magic or mask to bytes
+func parseEscaped(data string) ([]byte, error) {
+	out := []byte{}
+	for _, b := range strings.Split(data, `\x`)[1:] {
+		if len(b) < 2 {
+			return out, fmt.Errorf("Truncated escape sequence in '%s'", data)
+		}
+		v, err := strconv.ParseUint(b[:2], 16, 8)
+		if err != nil {
+			return out, fmt.Errorf("Invalid escape sequence '\\x%s' in '%s'", b[:2], data)
+		}
+		out = append(out, byte(v))
+		out = append(out, []byte(b[2:])...) // Printable characters, like "ELF"
+	}
+	return out, nil
+}
+
+// unescape "\x.." notation of binfmt magic or mask to bytes, skipping the broken rest
+func unescape(data string) []byte {
+	out, _ := parseEscaped(data)
+	return out
+}
+
+// MagicBytes returns binary ELF header magic of the architecture
+func (a Arch) MagicBytes() []byte {
+	return unescape(a.Magic)
+}
+
+// MaskBytes returns binary mask of the ELF header magic of the architecture
+func (a Arch) MaskBytes() []byte {
+	return unescape(a.Mask)
+}
+
+// IsBigEndian returns true, if the architecture is big-endian, according to the ELF data encoding
+func (a Arch) IsBigEndian() bool {
+	magic := a.MagicBytes()
+	return len(magic) > elf.EI_DATA && elf.Data(magic[elf.EI_DATA]) == elf.ELFDATA2MSB
+}
+
+// LibPath returns library directories of the architecture within the root, multiarch ones first
+func (a Arch) LibPath(root string) []string {
+	dirs := []string{}
+	if a.Multiarch != "" {
+		dirs = append(dirs, path.Join(root, "/usr/lib", a.Multiarch), path.Join(root, "/lib", a.Multiarch))
+	}
+	dirs = append(dirs, path.Join(root, "/usr/lib"), path.Join(root, "/lib"))
+	if a.CPUBit == 0x40 {
+		dirs = append(dirs, path.Join(root, "/usr/lib64"), path.Join(root, "/lib64"))
+	} else if a.Name == "mipsn32" {
+		dirs = append(dirs, path.Join(root, "/usr/lib32"), path.Join(root, "/lib32"))
+	}
+	return dirs
+}
+
+// SetFlags of the binfmt_misc registration:
+//
+//	F: fix binary, so the interpreter is opened at registration and works also in containers and chroots
+//	P: preserve original argv[0] of the called binary
+//	O: open the binary and pass it to the interpreter as a descriptor, e.g. for non-readable binaries
+//	C: calculate credentials from the binary (setuid), implies O
+func (bf *BinFormat) SetFlags(flags string) error {
+	bf.flags = ""
+	for _, f := range strings.ToUpper(flags) {
+		if !strings.ContainsRune("FPOC", f) {
+			return fmt.Errorf("Unknown binfmt_misc flag: %c", f)
+		}
+		if !strings.ContainsRune(bf.flags, f) {
+			bf.flags += string(f)
+		}
+	}
+	return nil
+}
+
 // Get formatted registrar string for the binfmt
 func (bf BinFormat) format(arch string) (string, string, error) {
 	a, err := bf.GetArch(arch)
@@ -107,7 +351,7 @@ func (bf BinFormat) format(arch string) (string, string, error) {
 	}
 
 	target := fmt.Sprintf("sysroot_%s", a.Name)
-	return target, fmt.Sprintf(":%s:M::%s:%s:/usr/bin/sysroot-manager:", target, a.Magic, a.Mask), nil
+	return target, fmt.Sprintf(":%s:M::%s:%s:/usr/bin/sysroot-manager:%s", target, a.Magic, a.Mask, bf.flags), nil
 }
 
 // Unregister specific architecture. If architecture registration does not exist yet, just pass-through.
@@ -0,0 +1,119 @@
+package sysmgr_arch
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// MIPS n32 ABI flag in the ELF header
+const efMipsABI2 = 0x20
+
+// ElfInfo is what the gate needs to know about a binary to run it
+type ElfInfo struct {
+	Interp  string   // Requested dynamic linker (PT_INTERP), empty for static binaries
+	RPath   []string // DT_RPATH
+	RunPath []string // DT_RUNPATH
+}
+
+// ReadElfInfo reads the dynamic linker and library search paths of the binary
+func ReadElfInfo(pth string) (*ElfInfo, error) {
+	bin, err := elf.Open(pth)
+	if err != nil {
+		return nil, err
+	}
+	defer bin.Close()
+
+	info := &ElfInfo{RPath: []string{}, RunPath: []string{}}
+	for _, prog := range bin.Progs {
+		if prog.Type == elf.PT_INTERP {
+			data, err := io.ReadAll(prog.Open())
+			if err != nil {
+				return nil, err
+			}
+			info.Interp = strings.TrimRight(string(data), "\x00")
+		}
+	}
+
+	for tag, paths := range map[elf.DynTag]*[]string{elf.DT_RPATH: &info.RPath, elf.DT_RUNPATH: &info.RunPath} {
+		entries, err := bin.DynString(tag)
+		if err != nil {
+			continue // Static binaries have no dynamic section
+		}
+		for _, entry := range entries {
+			for _, p := range strings.Split(entry, ":") {
+				if p != "" {
+					*paths = append(*paths, p)
+				}
+			}
+		}
+	}
+
+	return info, nil
+}
+
+// GetArchByELF returns an architecture of the binary, matching its ELF header the same way as binfmt_misc does.
+// Architectures with the same header (e.g. MIPS o32 and n32) are told apart by the ELF flags.
+func (bf BinFormat) GetArchByELF(pth string) (*Arch, error) {
+	fh, err := os.Open(pth)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	header := make([]byte, 0x40)
+	n, err := io.ReadFull(fh, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	header = header[:n]
+
+	candidates := []*Arch{}
+	for _, a := range bf.Architectures {
+		magic, mask := a.MagicBytes(), a.MaskBytes()
+		if len(magic) == 0 || len(header) < len(magic) {
+			continue
+		}
+		matches := true
+		for i := range magic {
+			m := byte(0xff)
+			if i < len(mask) {
+				m = mask[i]
+			}
+			if header[i]&m != magic[i]&m {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			candidates = append(candidates, a)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil, fmt.Errorf("Unknown architecture of %s", pth)
+	case 1:
+		return candidates[0], nil
+	}
+
+	// Ambiguous header, only MIPS ABIs are known to share it
+	n32 := false
+	if len(header) >= 0x34 && elf.Class(header[elf.EI_CLASS]) == elf.ELFCLASS32 {
+		var order binary.ByteOrder = binary.LittleEndian
+		if elf.Data(header[elf.EI_DATA]) == elf.ELFDATA2MSB {
+			order = binary.BigEndian
+		}
+		n32 = order.Uint32(header[0x24:])&efMipsABI2 != 0
+	}
+	for _, a := range candidates {
+		if (a.Name == "mipsn32") == n32 {
+			return a, nil
+		}
+	}
+
+	return candidates[0], nil
+}
@@ -0,0 +1,183 @@
+package sysmgr_arch
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-yaml/yaml"
+)
+
+// ArchConfigDir contains architecture definitions, one per a YAML file.
+// Definitions with a name of a built-in architecture are overriding only given fields of it.
+var ArchConfigDir string = "/etc/sysroots.d/arch"
+
+// archConfig are fields of the architecture definition, which need parsing
+type archConfig struct {
+	Name    string      `yaml:"name"`
+	Magic   string      `yaml:"magic"`
+	Machine interface{} `yaml:"machine"`
+	Bits    *int        `yaml:"bits"`
+	Endian  string      `yaml:"endian"`
+}
+
+// parseMachine from an ELF machine name (e.g. "EM_RISCV") or a number
+func parseMachine(machine interface{}) (elf.Machine, error) {
+	switch m := machine.(type) {
+	case int:
+		return elf.Machine(m), nil
+	case string:
+		if n, err := strconv.ParseUint(m, 0, 16); err == nil {
+			return elf.Machine(n), nil
+		}
+		for i := 0; i < 0x10000; i++ {
+			if elf.Machine(i).String() == strings.ToUpper(m) {
+				return elf.Machine(i), nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("Unknown ELF machine: %v", machine)
+}
+
+// generateMagic of an executable or shared object ELF header for the architecture by machine, bits and endianness
+func (a *Arch) generateMagic() error {
+	if a.Machine == 0 {
+		return fmt.Errorf("Either magic and mask or ELF machine should be defined")
+	}
+
+	class, data := elf.ELFCLASS32, elf.ELFDATA2LSB
+	if a.CPUBit == 0x40 {
+		class = elf.ELFCLASS64
+	} else if a.CPUBit != 0x20 {
+		return fmt.Errorf("Unsupported bits: %d", a.CPUBit)
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	emask := []byte{0xfe, 0xff, 0xff, 0xff}
+	if a.Endian == "big" {
+		order, data = binary.BigEndian, elf.ELFDATA2MSB
+		emask = []byte{0xff, 0xfe, 0xff, 0xff}
+	}
+
+	magic := []byte{0x7f, 'E', 'L', 'F', byte(class), byte(data), byte(elf.EV_CURRENT)}
+	magic = append(magic, make([]byte, elf.EI_NIDENT-len(magic))...)
+	tail := make([]byte, 4)
+	order.PutUint16(tail, uint16(elf.ET_EXEC))
+	order.PutUint16(tail[2:], uint16(a.Machine))
+	magic = append(magic, tail...)
+
+	mask := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x00}
+	mask = append(mask, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}...)
+	mask = append(mask, emask...)
+
+	a.Magic, a.Mask = `\x7fELF`, ""
+	for _, b := range magic[4:] {
+		a.Magic += fmt.Sprintf(`\x%02x`, b)
+	}
+	for _, b := range mask {
+		a.Mask += fmt.Sprintf(`\x%02x`, b)
+	}
+
+	return nil
+}
+
+// fillDefaults of the architecture, which are not defined. All tool-specific names are the same by default.
+func (a *Arch) fillDefaults() {
+	magic := a.MagicBytes()
+	if a.Endian == "" {
+		a.Endian = "little"
+		if a.IsBigEndian() {
+			a.Endian = "big"
+		}
+	}
+	if a.Machine == 0 && len(magic) >= elf.EI_NIDENT+4 {
+		var order binary.ByteOrder = binary.LittleEndian
+		if a.IsBigEndian() {
+			order = binary.BigEndian
+		}
+		a.Machine = elf.Machine(order.Uint16(magic[elf.EI_NIDENT+2:]))
+	}
+
+	for _, name := range []*string{&a.Qemu, &a.DpkgArch, &a.RpmArch, &a.OciArch, &a.Family} {
+		if *name == "" {
+			*name = a.Name
+		}
+	}
+}
+
+// loadArchitecture from a YAML definition. Known architecture is updated only by given fields.
+func (bf *BinFormat) loadArchitecture(cfgpath string) error {
+	data, err := ioutil.ReadFile(cfgpath)
+	if err != nil {
+		return err
+	}
+
+	cfg := &archConfig{}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return err
+	}
+	if cfg.Name == "" {
+		return fmt.Errorf("Architecture has no name")
+	}
+
+	known, _ := bf.GetArch(cfg.Name)
+	a := &Arch{}
+	if known != nil {
+		*a = *known
+	}
+	if err := yaml.Unmarshal(data, a); err != nil {
+		return err
+	}
+
+	if cfg.Machine != nil {
+		if a.Machine, err = parseMachine(cfg.Machine); err != nil {
+			return err
+		}
+	}
+
+	// Magic is generated, unless given explicitly or inherited unchanged from the built-in
+	if cfg.Magic == "" && (known == nil || cfg.Machine != nil || cfg.Bits != nil || cfg.Endian != "") {
+		if err := a.generateMagic(); err != nil {
+			return err
+		}
+	}
+	magic, err := parseEscaped(a.Magic)
+	if err != nil {
+		return err
+	}
+	mask, err := parseEscaped(a.Mask)
+	if err != nil {
+		return err
+	}
+	if len(magic) != len(mask) {
+		return fmt.Errorf("Magic and mask have different length")
+	}
+
+	a.fillDefaults()
+	if known != nil {
+		*known = *a
+	} else {
+		bf.Architectures = append(bf.Architectures, a)
+	}
+
+	return nil
+}
+
+// loadArchitectures from all definitions in the directory, on top of the built-in ones.
+// Broken definitions are skipped.
+func (bf *BinFormat) loadArchitectures(cfgdir string) {
+	for _, a := range bf.Architectures {
+		a.fillDefaults()
+	}
+
+	cfgs, _ := filepath.Glob(filepath.Join(cfgdir, "*.yaml"))
+	for _, cfgpath := range cfgs {
+		if err := bf.loadArchitecture(cfgpath); err != nil {
+			bf.GetLogger().Warningf("Skipping architecture definition %s: %s", cfgpath, err.Error())
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package sysmgr_arch
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// BinFmtEntry is a handler, registered in binfmt_misc
+type BinFmtEntry struct {
+	Name               string   `json:"name" yaml:"name"`
+	Enabled            bool     `json:"enabled" yaml:"enabled"`
+	Interpreter        string   `json:"interpreter" yaml:"interpreter"`
+	InterpreterMissing bool     `json:"interpreter_missing" yaml:"interpreter_missing"`
+	Flags              string   `json:"flags" yaml:"flags"`
+	Offset             int      `json:"offset" yaml:"offset"`
+	Magic              string   `json:"magic,omitempty" yaml:"magic,omitempty"`
+	Mask               string   `json:"mask,omitempty" yaml:"mask,omitempty"`
+	Extension          string   `json:"extension,omitempty" yaml:"extension,omitempty"`
+	Conflicts          []string `json:"conflicts" yaml:"conflicts"`
+}
+
+// IsOwn returns true if the entry is registered by the system root manager
+func (e BinFmtEntry) IsOwn() bool {
+	return strings.HasPrefix(e.Name, "sysroot_")
+}
+
+// matches returns true if both magic/mask pairs can match the same binary
+func (e BinFmtEntry) matches(magic []byte, mask []byte, offset int) bool {
+	if e.Magic == "" || e.Offset != offset {
+		return false
+	}
+
+	emagic, err := hex.DecodeString(e.Magic)
+	if err != nil {
+		return false
+	}
+	emask, err := hex.DecodeString(e.Mask)
+	if err != nil || e.Mask == "" {
+		emask = bytes.Repeat([]byte{0xff}, len(emagic))
+	}
+
+	for i := 0; i < len(emagic) && i < len(magic); i++ {
+		m := byte(0xff)
+		if i < len(emask) {
+			m &= emask[i]
+		}
+		if i < len(mask) {
+			m &= mask[i]
+		}
+		if emagic[i]&m != magic[i]&m {
+			return false
+		}
+	}
+	return true
+}
+
+// IsEnabled returns true if binfmt_misc is mounted and enabled globally
+func (bf BinFormat) IsEnabled() (bool, error) {
+	data, err := ioutil.ReadFile(path.Join(bf.bfmtMisc, "status"))
+	if err != nil {
+		return false, fmt.Errorf("binfmt_misc is not available at %s: %s", bf.bfmtMisc, err.Error())
+	}
+	return strings.TrimSpace(string(data)) == "enabled", nil
+}
+
+// readEntry parses a binfmt_misc entry
+func (bf BinFormat) readEntry(name string) (*BinFmtEntry, error) {
+	data, err := ioutil.ReadFile(path.Join(bf.bfmtMisc, name))
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &BinFmtEntry{Name: name, Conflicts: []string{}}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "enabled" {
+			entry.Enabled = true
+			continue
+		}
+
+		kv := strings.SplitN(line, " ", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch strings.TrimSuffix(kv[0], ":") {
+		case "interpreter":
+			entry.Interpreter = kv[1]
+		case "flags":
+			entry.Flags = kv[1]
+		case "offset":
+			entry.Offset, _ = strconv.Atoi(kv[1])
+		case "magic":
+			entry.Magic = kv[1]
+		case "mask":
+			entry.Mask = kv[1]
+		case "extension":
+			entry.Extension = kv[1]
+		}
+	}
+
+	if _, err := os.Stat(entry.Interpreter); err != nil {
+		entry.InterpreterMissing = true
+	}
+
+	return entry, nil
+}
+
+// GetEntry returns a handler of the system root manager for the architecture, if it is registered
+func (bf BinFormat) GetEntry(arch string) (*BinFmtEntry, error) {
+	return bf.readEntry(fmt.Sprintf("sysroot_%s", arch))
+}
+
+// HasFlag returns true if the handler is registered with a given flag
+func (e BinFmtEntry) HasFlag(flag rune) bool {
+	return strings.ContainsRune(e.Flags, flag)
+}
+
+// GetEntries returns all handlers, registered in binfmt_misc.
+// Handlers of other packages, claiming the same binaries as the architectures of the system root manager, are
+// marked as conflicting with "sysroot_<arch>" and vice versa.
+func (bf BinFormat) GetEntries() ([]*BinFmtEntry, error) {
+	if _, err := bf.IsEnabled(); err != nil {
+		return nil, err
+	}
+
+	files, err := ioutil.ReadDir(bf.bfmtMisc)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []*BinFmtEntry{}
+	own := map[string]*BinFmtEntry{}
+	for _, f := range files {
+		if f.IsDir() || f.Name() == "register" || f.Name() == "status" {
+			continue
+		}
+		entry, err := bf.readEntry(f.Name())
+		if err != nil {
+			bf.GetLogger().Debugf("Unable to read binfmt_misc entry %s: %s", f.Name(), err.Error())
+			continue
+		}
+		entries = append(entries, entry)
+		if entry.IsOwn() {
+			own[entry.Name] = entry
+		}
+	}
+
+	for _, entry := range entries {
+		if entry.IsOwn() || !entry.Enabled {
+			continue
+		}
+		for _, arch := range bf.Architectures {
+			if entry.matches(arch.MagicBytes(), arch.MaskBytes(), 0) {
+				target := fmt.Sprintf("sysroot_%s", arch.Name)
+				entry.Conflicts = append(entry.Conflicts, target)
+				if o, ex := own[target]; ex {
+					o.Conflicts = append(o.Conflicts, entry.Name)
+				}
+			}
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	return entries, nil
+}
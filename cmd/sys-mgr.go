@@ -118,6 +118,50 @@ OPTIONS:
 					Aliases: []string{"p"},
 					Usage:   "Display path of an active system root",
 				},
+				&cli.BoolFlag{
+					Name:  "clone",
+					Usage: "Clone a system root under a new name (see --to)",
+				},
+				&cli.BoolFlag{
+					Name:  "rename",
+					Usage: "Rename a system root (see --to)",
+				},
+				&cli.BoolFlag{
+					Name:  "snapshot",
+					Usage: "Take a snapshot of a system root",
+				},
+				&cli.BoolFlag{
+					Name:  "snapshots",
+					Usage: "List snapshots of all or a specified system root",
+				},
+				&cli.BoolFlag{
+					Name:  "restore",
+					Usage: "Restore a system root from a snapshot (the latest, unless tag is set)",
+				},
+				&cli.StringFlag{
+					Name:  "from-oci",
+					Usage: "Create a system root from a local OCI image layout or saved Docker image",
+				},
+				&cli.StringFlag{
+					Name:  "export",
+					Usage: "Export a system root to a compressed archive (.tar.zst or .tar.xz)",
+				},
+				&cli.StringFlag{
+					Name:  "import",
+					Usage: "Import a system root from a previously exported archive",
+				},
+				&cli.StringFlag{
+					Name:  "toolchain",
+					Usage: "Print cross-compilation setup of a system root for a build system. Choices: cmake, meson, autotools.",
+				},
+				&cli.BoolFlag{
+					Name:  "run",
+					Usage: "Run a binary of the system root architecture without binfmt_misc, e.g. --run -- ./hello --verbose",
+				},
+				&cli.BoolFlag{
+					Name:  "binfmt-status",
+					Usage: "Show handlers, registered in binfmt_misc, and their conflicts with system root architectures",
+				},
 				&cli.StringFlag{
 					Name:    "name",
 					Aliases: []string{"n"},
@@ -128,6 +172,29 @@ OPTIONS:
 					Aliases: []string{"a"},
 					Usage:   fmt.Sprintf("Set architecture for the system root. Choices: %s.", strings.Join(sm.Architectures(), ", ")),
 				},
+				&cli.StringFlag{
+					Name:  "to",
+					Usage: "Set new name of the system root",
+				},
+				&cli.StringFlag{
+					Name:    "format",
+					Aliases: []string{"f"},
+					Usage:   "Set machine-readable output format of --list, --path and --binfmt-status. Choices: json, yaml, tsv.",
+				},
+				&cli.StringFlag{
+					Name:    "tag",
+					Aliases: []string{"t"},
+					Usage:   "Set tag of the snapshot",
+				},
+				&cli.BoolFlag{
+					Name:  "wait",
+					Value: true,
+					Usage: "Wait for other processes, working on the same system roots (default)",
+				},
+				&cli.BoolFlag{
+					Name:  "no-wait",
+					Usage: "Fail immediately, if system roots are locked by another process",
+				},
 				&cli.BoolFlag{
 					Name:  "verbose",
 					Usage: "Show debugging log",
@@ -170,12 +237,14 @@ COPYRIGHT:{{template "copyrightTemplate" .}}{{end}}
    `
 
 	var err error
-	if len(os.Args) == 1 || sysmgr_lib.Any(os.Args, "sysroot", "-h", "--help") {
+	// Only own command and help go to the app, anything else belongs to the package manager or a binary to run
+	if len(os.Args) == 1 || sysmgr_lib.Any(os.Args[1:2], "sysroot", "-h", "--help") {
 		err = app.Run(os.Args)
 	} else {
 		err = sm.RunPackageManager()
 	}
 	if err != nil {
 		wzlib_logger.GetCurrentLogger().Errorf("General error: %s", err.Error())
+		os.Exit(1)
 	}
 }
@@ -4,6 +4,7 @@ go 1.18
 
 require (
 	github.com/elastic/go-sysinfo v1.9.0
+	github.com/go-yaml/yaml v2.1.0+incompatible
 	github.com/infra-whizz/wzlib v0.0.0-20210306212611-2af49aea1704
 	github.com/isbm/go-nanoconf v0.0.0-20210917204429-663038ee6e05
 	github.com/isbm/go-shutil v0.0.0-20200707163617-60e3684d72ba
@@ -19,7 +20,6 @@ require (
 	github.com/cpuguy83/go-md2man/v2 v2.0.2 // indirect
 	github.com/elastic/go-windows v1.0.1 // indirect
 	github.com/go-ole/go-ole v1.2.6 // indirect
-	github.com/go-yaml/yaml v2.1.0+incompatible // indirect
 	github.com/google/uuid v1.3.0 // indirect
 	github.com/joeshaw/multierror v0.0.0-20140124173710-69b34d4ec901 // indirect
 	github.com/oklog/ulid v1.3.1 // indirect
@@ -2,7 +2,12 @@ package sysmgr_lib
 
 import (
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
 )
 
 // IsMounted checks if a directory is still mounted or not
@@ -22,3 +27,116 @@ func IsMounted(pth string) bool {
 
 	return false
 }
+
+// IsBtrfs checks if the path is placed on a btrfs filesystem
+func IsBtrfs(pth string) bool {
+	var st unix.Statfs_t
+	if err := unix.Statfs(pth, &st); err != nil {
+		return false
+	}
+	return st.Type == unix.BTRFS_SUPER_MAGIC
+}
+
+// IsBtrfsSubvolume checks if the path is a root of a btrfs subvolume.
+// Each subvolume root has always the same inode number.
+func IsBtrfsSubvolume(pth string) bool {
+	if !IsBtrfs(pth) {
+		return false
+	}
+
+	var st unix.Stat_t
+	if err := unix.Stat(pth, &st); err != nil {
+		return false
+	}
+	return st.Ino == 256
+}
+
+// MakeTreeRoot creates a directory for a tree. On btrfs it is a subvolume, so it can be snapshotted later.
+func MakeTreeRoot(pth string) error {
+	if err := os.MkdirAll(filepath.Dir(pth), 0755); err != nil {
+		return err
+	}
+	if IsBtrfs(filepath.Dir(pth)) {
+		return LoggedExec("btrfs", "subvolume", "create", pth)
+	}
+	return os.MkdirAll(pth, 0755)
+}
+
+// RemoveTree removes a tree, which might be a btrfs subvolume
+func RemoveTree(pth string) error {
+	if IsBtrfsSubvolume(pth) {
+		return LoggedExec("btrfs", "subvolume", "delete", pth)
+	}
+	return os.RemoveAll(pth)
+}
+
+// CopyTree copies the entire directory tree, preserving ownership, permissions,
+// xattrs, device nodes and hardlinks. Copy-on-write is used, if filesystem supports it.
+func CopyTree(src string, dst string) error {
+	return LoggedExec("cp", "--archive", "--preserve=all", "--reflink=auto", "--no-target-directory", src, dst)
+}
+
+// DiskUsage returns amount of bytes, allocated by the directory tree.
+// Other mounted filesystems are skipped, hardlinks are counted once.
+func DiskUsage(pth string) (int64, error) {
+	var root unix.Stat_t
+	if err := unix.Lstat(pth, &root); err != nil {
+		return 0, err
+	}
+
+	var usage int64
+	seen := map[uint64]bool{}
+	err := filepath.Walk(pth, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		st, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return nil
+		}
+		if uint64(st.Dev) != uint64(root.Dev) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if st.Nlink > 1 && !info.IsDir() {
+			if seen[st.Ino] {
+				return nil
+			}
+			seen[st.Ino] = true
+		}
+		usage += st.Blocks * 512
+
+		return nil
+	})
+
+	return usage, err
+}
+
+// WriteFileAtomic writes data to a temporary file next to the target and renames it over,
+// so readers see either old or new content, but never a partial one.
+func WriteFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	fh, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(fh.Name())
+
+	if _, err := fh.Write(data); err != nil {
+		fh.Close()
+		return err
+	}
+	if err := fh.Sync(); err != nil {
+		fh.Close()
+		return err
+	}
+	if err := fh.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(fh.Name(), perm); err != nil {
+		return err
+	}
+
+	return os.Rename(fh.Name(), filename)
+}
@@ -1,6 +1,7 @@
 package sysmgr_lib
 
 import (
+	"fmt"
 	"os"
 	"os/exec"
 	"strings"
@@ -26,6 +27,20 @@ func LoggedExec(cmd string, args ...string) error {
 	return out.Run()
 }
 
+// LoggedEnvExec is the same as LoggedExec, but with an additional environment
+func LoggedEnvExec(env map[string]string, cmd string, args ...string) error {
+	wzlib_logger.GetCurrentLogger().Debugf("Calling: %s %v with %v", cmd, args, env)
+	out := exec.Command(cmd, args...)
+	out.Env = os.Environ()
+	for k, v := range env {
+		out.Env = append(out.Env, fmt.Sprintf("%s=%s", k, v))
+	}
+	out.Stdin = os.Stdin
+	out.Stdout = &StdoutLogger{}
+	out.Stderr = os.Stderr
+	return out.Run()
+}
+
 func StdoutExec(cmd string, args ...string) error {
 	out := exec.Command(cmd, args...)
 	out.Stdin = os.Stdin
@@ -0,0 +1,51 @@
+package sysmgr_lib
+
+import (
+	"debug/elf"
+	"fmt"
+	"os/exec"
+)
+
+// QemuPatterns are names of QEMU user emulators, checked in this order after distro-specific ones
+var QemuPatterns = []string{"qemu-%s-static", "qemu-%s"}
+
+// Distro-specific names of QEMU user emulators, checked first. E.g. openSUSE ships static ones without a suffix.
+var qemuDistroPatterns = map[string][]string{
+	"opensuse-leap": {"qemu-%s"},
+}
+
+// IsStatic returns true, if the binary is an ELF without a dynamic linker
+func IsStatic(pth string) bool {
+	bin, err := elf.Open(pth)
+	if err != nil {
+		return false
+	}
+	defer bin.Close()
+
+	for _, prog := range bin.Progs {
+		if prog.Type == elf.PT_INTERP {
+			return false
+		}
+	}
+	return true
+}
+
+// FindQemu returns a path to the QEMU user emulator by its name, e.g. "aarch64" for "qemu-aarch64".
+// If static is set, only statically linked emulators are accepted, as only they are working inside a system root.
+func FindQemu(name string, static bool) (string, error) {
+	for _, pattern := range append(qemuDistroPatterns[GetCurrentPlatform()], QemuPatterns...) {
+		qemu, err := exec.LookPath(fmt.Sprintf(pattern, name))
+		if err != nil {
+			continue
+		}
+		if static && !IsStatic(qemu) {
+			continue
+		}
+		return qemu, nil
+	}
+
+	if static {
+		return "", fmt.Errorf("No static QEMU found for %s", name)
+	}
+	return "", fmt.Errorf("No QEMU found for %s", name)
+}
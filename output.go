@@ -0,0 +1,147 @@
+package sysmgr
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-yaml/yaml"
+	sysmgr_arch "github.com/infra-whizz/sys-mgr/arch"
+	sysmgr_lib "github.com/infra-whizz/sys-mgr/lib"
+	sysmgr_sr "github.com/infra-whizz/sys-mgr/sr"
+)
+
+// SysrootInfo is a machine-readable description of a system root
+type SysrootInfo struct {
+	Name        string          `json:"name" yaml:"name"`
+	Arch        string          `json:"arch" yaml:"arch"`
+	Path        string          `json:"path" yaml:"path"`
+	Default     bool            `json:"default" yaml:"default"`
+	Distro      string          `json:"distro" yaml:"distro"`
+	Codename    string          `json:"codename" yaml:"codename"`
+	DiskUsage   int64           `json:"disk_usage" yaml:"disk_usage"`
+	Mounts      map[string]bool `json:"mounts" yaml:"mounts"`
+	Provisioner string          `json:"provisioner" yaml:"provisioner"`
+	Created     time.Time       `json:"created" yaml:"created"`
+}
+
+// Runtime directories, bound from the host
+var sysrootBinds = []string{"/proc", "/dev", "/sys", "/run"}
+
+// getSysrootInfo collects all the details of a system root
+func (srm SysrootManager) getSysrootInfo(sr *sysmgr_sr.SysRoot) (*SysrootInfo, error) {
+	release := sr.GetOSRelease()
+	info := &SysrootInfo{
+		Name:        sr.Name,
+		Arch:        sr.Arch,
+		Path:        sr.Path,
+		Default:     sr.Default,
+		Distro:      release["ID"],
+		Codename:    release["VERSION_CODENAME"],
+		Mounts:      map[string]bool{},
+		Provisioner: sr.Provisioner,
+		Created:     sr.Created,
+	}
+
+	// System roots, created by older versions, have no provisioner recorded
+	if info.Provisioner == "" {
+		provisioner, err := sr.GetProvisioner()
+		if err != nil {
+			return nil, err
+		}
+		info.Provisioner = provisioner.GetType()
+	}
+
+	for _, d := range sysrootBinds {
+		info.Mounts[d] = sysmgr_lib.IsMounted(path.Join(sr.Path, d))
+	}
+
+	var err error
+	if info.DiskUsage, err = sysmgr_lib.DiskUsage(sr.Path); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// printBinfmtEntries to the stdout in a machine-readable format: json, yaml or tsv
+func (srm SysrootManager) printBinfmtEntries(format string, enabled bool, entries []*sysmgr_arch.BinFmtEntry) error {
+	status := map[string]interface{}{"enabled": enabled, "entries": entries}
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(status, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	case "yaml":
+		data, err := yaml.Marshal(status)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+	case "tsv":
+		fmt.Println(strings.Join([]string{"name", "enabled", "interpreter", "interpreter_missing", "flags", "offset", "conflicts"}, "\t"))
+		for _, e := range entries {
+			fmt.Println(strings.Join([]string{e.Name, fmt.Sprintf("%v", e.Enabled), e.Interpreter, fmt.Sprintf("%v", e.InterpreterMissing),
+				e.Flags, fmt.Sprintf("%d", e.Offset), strings.Join(e.Conflicts, ",")}, "\t"))
+		}
+	default:
+		return fmt.Errorf("Unknown output format: %s", format)
+	}
+
+	return nil
+}
+
+// printSysroots to the stdout in a machine-readable format: json, yaml or tsv.
+// If single is set, only one system root is expected and printed as an object rather than a list.
+func (srm SysrootManager) printSysroots(format string, roots []*sysmgr_sr.SysRoot, single bool) error {
+	infos := []*SysrootInfo{}
+	for _, sr := range roots {
+		info, err := srm.getSysrootInfo(sr)
+		if err != nil {
+			return err
+		}
+		infos = append(infos, info)
+	}
+
+	var out interface{} = infos
+	if single && len(infos) == 1 {
+		out = infos[0]
+	}
+
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	case "yaml":
+		data, err := yaml.Marshal(out)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+	case "tsv":
+		header := []string{"name", "arch", "path", "default", "distro", "codename", "disk_usage"}
+		for _, d := range sysrootBinds {
+			header = append(header, strings.TrimPrefix(d, "/"))
+		}
+		fmt.Println(strings.Join(append(header, "provisioner", "created"), "\t"))
+		for _, info := range infos {
+			row := []string{info.Name, info.Arch, info.Path, fmt.Sprintf("%v", info.Default), info.Distro, info.Codename,
+				fmt.Sprintf("%d", info.DiskUsage)}
+			for _, d := range sysrootBinds {
+				row = append(row, fmt.Sprintf("%v", info.Mounts[d]))
+			}
+			fmt.Println(strings.Join(append(row, info.Provisioner, info.Created.Format(time.RFC3339)), "\t"))
+		}
+	default:
+		return fmt.Errorf("Unknown output format: %s", format)
+	}
+
+	return nil
+}
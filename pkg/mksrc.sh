@@ -3,9 +3,9 @@
 # Configuration
 P_NAME="sysroot-manager"
 P_APP="cmd/sys-mgr.go"
-P_SRC_DIRS=("arch" "pm" "pm/fixlets" "sr" "lib" "cmd")
+P_SRC_DIRS=("arch" "pm" "pm/fixlets" "sr" "lib" "toolchain" "cmd")
 P_DOC_DIRS=("etc")
-P_FILES=("LICENSE" "README.md" "go.mod" "go.sum" "sysmgr.go")
+P_FILES=("LICENSE" "README.md" "go.mod" "go.sum" "sysmgr.go" "output.go" "pkgconfig.go")
 P_CMD=("Makefile")
 
 set -e
@@ -0,0 +1,71 @@
+package sysmgr
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	sysmgr_arch "github.com/infra-whizz/sys-mgr/arch"
+	sysmgr_toolchain "github.com/infra-whizz/sys-mgr/toolchain"
+	wzlib_logger "github.com/infra-whizz/wzlib/logger"
+)
+
+// Suffix of the binary name for pkg-config multi-call mode, e.g. "aarch64-linux-gnu-pkg-config"
+var PkgConfigSuffix string = "-pkg-config"
+
+// getTripletArch returns an architecture by a GNU triplet prefix of the binary name
+func (srm SysrootManager) getTripletArch(appname string) (*sysmgr_arch.Arch, error) {
+	triplet := strings.TrimSuffix(appname, PkgConfigSuffix)
+	for _, arch := range srm.binfmt.Architectures {
+		for _, t := range append([]string{arch.Multiarch}, arch.Triplets...) {
+			if t == triplet {
+				return arch, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("Unknown target triplet: %s", triplet)
+}
+
+// RunPkgConfig calls pkg-config of the host, locked to .pc files of the system root only.
+// All returned include and library paths are prefixed with the system root path by pkg-config itself.
+func (srm SysrootManager) RunPkgConfig() error {
+	arch, err := srm.getTripletArch(srm.appname)
+	if err != nil {
+		return err
+	}
+
+	id, _, args := srm.popGlobalArgs(os.Args[1:])
+	sysroot, err := srm.mgr.GetSelectedSysroot(id)
+	if err != nil {
+		return err
+	}
+	if sysroot.Arch != arch.Name {
+		return fmt.Errorf("System root %s is for %s architecture, but %s is called", sysroot.Name, sysroot.Arch, srm.appname)
+	}
+
+	cmd := exec.Command("pkg-config", args...)
+	cmd.Env = []string{}
+	for _, env := range os.Environ() {
+		if !strings.HasPrefix(env, "PKG_CONFIG_PATH=") && !strings.HasPrefix(env, "PKG_CONFIG_LIBDIR=") &&
+			!strings.HasPrefix(env, "PKG_CONFIG_SYSROOT_DIR=") {
+			cmd.Env = append(cmd.Env, env)
+		}
+	}
+	cmd.Env = append(cmd.Env,
+		fmt.Sprintf("PKG_CONFIG_LIBDIR=%s", strings.Join(sysmgr_toolchain.PkgConfigDirs(sysroot, arch), ":")),
+		fmt.Sprintf("PKG_CONFIG_SYSROOT_DIR=%s", sysroot.Path))
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	wzlib_logger.GetCurrentLogger().Debugf("Calling pkg-config %v with %v", args, cmd.Env)
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			os.Exit(exitErr.ExitCode())
+		}
+		return err
+	}
+
+	return nil
+}
@@ -28,6 +28,7 @@ func NewAptPackageManager() *AptPackageManager {
 	pm.dpkgCommands = []string{"list-installed", "installed", "files", "content"}
 	pm.dpkgConverse = map[string]string{"list-installed": "-l", "installed": "-l", "files": "-L", "content": "-L"}
 	pm.chrooted = []string{"install", "reinstall", "remove", "autoremove", "update", "upgrade", "full-upgrade", "satisfy", "purge"}
+	pm.mutating = []string{"install", "reinstall", "remove", "autoremove", "upgrade", "full-upgrade", "satisfy", "purge"}
 
 	return pm
 }
@@ -45,7 +46,11 @@ func (pm *AptPackageManager) Call(args ...string) error {
 		if err := sysmgr_lib.CheckUser(0, 0); err != nil {
 			cmd = append([]string{"sudo"}, cmd...)
 		}
-		return sysmgr_lib.StdoutExec(cmd[0], cmd[1:]...)
+		if err := sysmgr_lib.StdoutExec(cmd[0], cmd[1:]...); err != nil {
+			return err
+		}
+
+		return pm.afterTransaction(pm.sysroot, pm.GetLibcVersion, args...)
 	} else if sysmgr_lib.Any(pm.dpkgCommands, args[0]) {
 		return sysmgr_lib.StdoutExec(path.Join(pm.sysroot.Path, "usr", "bin", "dpkg"),
 			append([]string{"--root", pm.sysroot.Path, pm.dpkgConverse[args[0]]}, args[1:]...)...)
@@ -67,6 +72,12 @@ func (pm *AptPackageManager) SetSysroot(sysroot *sysmgr_sr.SysRoot) PackageManag
 	return pm
 }
 
+// SetFixlets to run after transactions
+func (pm *AptPackageManager) SetFixlets(fixlets []string) PackageManager {
+	pm.fixlets = fixlets
+	return pm
+}
+
 // Setup package manager
 // This is used to pre-setup a package manager for a multiarch
 func (pm *AptPackageManager) Setup() error {
@@ -74,6 +85,18 @@ func (pm *AptPackageManager) Setup() error {
 	return nil
 }
 
+// GetInstalledPackages from the dpkg database of the sysroot
+func (pm *AptPackageManager) GetInstalledPackages() ([]string, error) {
+	return pm.queryPackages("dpkg-query", "--admindir", path.Join(pm.sysroot.Path, "/var/lib/dpkg"),
+		"--show", "--showformat", "${Package}=${Version}\n")
+}
+
+// GetLibcVersion from the dpkg database of the sysroot
+func (pm *AptPackageManager) GetLibcVersion() string {
+	return pm.queryVersion("dpkg-query", "--admindir", path.Join(pm.sysroot.Path, "/var/lib/dpkg"),
+		"--show", "--showformat", "${Version}\n", "libc6")
+}
+
 func (pm *AptPackageManager) GetHelpFlags() map[string]string {
 	return map[string]string{
 		"list":                        "List packages based on package names",
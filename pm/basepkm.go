@@ -3,15 +3,21 @@ package sysmgr_pm
 import (
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 
+	sysmgr_fixlets "github.com/infra-whizz/sys-mgr/pm/fixlets"
+	sysmgr_sr "github.com/infra-whizz/sys-mgr/sr"
 	wzlib_logger "github.com/infra-whizz/wzlib/logger"
 	wzlib_subprocess "github.com/infra-whizz/wzlib/subprocess"
+	"github.com/thoas/go-funk"
 )
 
 // BasePackageManager mixin
 type BasePackageManager struct {
-	env map[string]string
+	env      map[string]string
+	fixlets  []string
+	mutating []string
 	wzlib_logger.WzLogger
 }
 
@@ -34,3 +40,58 @@ func (bpm *BasePackageManager) callPackageManager(name string, args ...string) e
 
 	return cmd.Run()
 }
+
+// queryPackages calls a package query and returns its non-empty output lines
+func (bpm *BasePackageManager) queryPackages(name string, args ...string) ([]string, error) {
+	out, err := wzlib_subprocess.ExecCommand(name, args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get list of packages: %s", err.Error())
+	}
+
+	packages := []string{}
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			packages = append(packages, line)
+		}
+	}
+	sort.Strings(packages)
+
+	return packages, nil
+}
+
+// IsMutating returns true, if the command of the package manager (first non-option argument) changes the system root
+func (bpm *BasePackageManager) IsMutating(args ...string) bool {
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			return funk.ContainsString(bpm.mutating, arg)
+		}
+	}
+	return false
+}
+
+// afterTransaction runs fixlets, if the transaction has changed the system root,
+// and invalidates the cached dynamic linker, if glibc has been changed.
+func (bpm *BasePackageManager) afterTransaction(sysroot *sysmgr_sr.SysRoot, libc func() string, args ...string) error {
+	if !bpm.IsMutating(args...) {
+		bpm.GetLogger().Debugf("Skipping fixlets for %v", args)
+		return nil
+	}
+	if err := sysmgr_fixlets.RunFixlets(sysroot, bpm.fixlets); err != nil {
+		return err
+	}
+
+	if sysroot.DynLinker != "" && libc() != sysroot.LibcVersion {
+		return sysroot.InvalidateLinkerCache()
+	}
+	return nil
+}
+
+// queryVersion of a single package or an empty string, if it is not installed
+func (bpm *BasePackageManager) queryVersion(name string, args ...string) string {
+	out, err := bpm.queryPackages(name, args...)
+	if err != nil || len(out) == 0 {
+		return ""
+	}
+	return out[0]
+}
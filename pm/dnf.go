@@ -0,0 +1,116 @@
+package sysmgr_pm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	sysmgr_sr "github.com/infra-whizz/sys-mgr/sr"
+)
+
+// DnfPackageManager object
+type DnfPackageManager struct {
+	sysroot *sysmgr_sr.SysRoot
+
+	BasePackageManager
+}
+
+// NewDnfPackageManager creates a dnf caller object
+func NewDnfPackageManager() *DnfPackageManager {
+	pm := new(DnfPackageManager)
+	pm.env = make(map[string]string)
+	pm.mutating = []string{"install", "reinstall", "remove", "erase", "autoremove", "upgrade", "update",
+		"upgrade-minimal", "downgrade", "distro-sync", "swap"}
+	return pm
+}
+
+// getArch returns an architecture name, as RPM knows it
+func (pm *DnfPackageManager) getArch() string {
+	return sysmgr_sr.GetArchNames(pm.sysroot.Arch).Rpm
+}
+
+// Call dnf
+func (pm *DnfPackageManager) Call(args ...string) error {
+	if pm.sysroot == nil {
+		return fmt.Errorf("No default sysroot has been found. Please specify one.")
+	}
+
+	opts := []string{
+		"--installroot", pm.sysroot.Path,
+		"--forcearch", pm.getArch(),
+		"--config", path.Join(pm.sysroot.Path, "/etc/dnf/dnf.conf"),
+		fmt.Sprintf("--setopt=reposdir=%s", path.Join(pm.sysroot.Path, "/etc/yum.repos.d")),
+	}
+
+	// Release version of the sysroot, which is not necessarily the same as on the host
+	releasever, err := ioutil.ReadFile(path.Join(pm.sysroot.Path, "/etc/dnf/vars/releasever"))
+	if err == nil && strings.TrimSpace(string(releasever)) != "" {
+		opts = append(opts, "--releasever", strings.TrimSpace(string(releasever)))
+	}
+
+	if err := pm.callPackageManager(pm.Name(), append(opts, args...)...); err != nil {
+		return err
+	}
+
+	return pm.afterTransaction(pm.sysroot, pm.GetLibcVersion, args...)
+}
+
+// Name of the package manager
+func (pm *DnfPackageManager) Name() string {
+	return "dnf"
+}
+
+// SetSysroot to work with
+func (pm *DnfPackageManager) SetSysroot(sysroot *sysmgr_sr.SysRoot) PackageManager {
+	pm.sysroot = sysroot
+	pm.sysroot.GetLogger().Debug("Dnf environment: ", pm.env)
+
+	return pm
+}
+
+// SetFixlets to run after transactions
+func (pm *DnfPackageManager) SetFixlets(fixlets []string) PackageManager {
+	pm.fixlets = fixlets
+	return pm
+}
+
+// Setup package manager
+func (pm *DnfPackageManager) Setup() error {
+	for _, d := range []string{"/etc/dnf/vars", "/etc/yum.repos.d"} {
+		d = path.Join(pm.sysroot.Path, d)
+		if _, err := os.Stat(d); os.IsNotExist(err) {
+			if err := os.MkdirAll(d, 0755); err != nil {
+				return err
+			}
+		}
+	}
+
+	var buff strings.Builder
+	buff.WriteString("[main]\n")
+	buff.WriteString("gpgcheck = True\n")
+	buff.WriteString("installonly_limit = 3\n")
+	buff.WriteString("clean_requirements_on_remove = True\n")
+	buff.WriteString("best = False\n")
+	buff.WriteString("skip_if_unavailable = True\n")
+	buff.WriteString(fmt.Sprintf("reposdir = %s\n", path.Join(pm.sysroot.Path, "/etc/yum.repos.d")))
+
+	pm.sysroot.GetLogger().Infof("Setting default architecture to DNF: %s", pm.getArch())
+
+	return ioutil.WriteFile(path.Join(pm.sysroot.Path, "/etc/dnf/dnf.conf"), []byte(buff.String()), 0644)
+}
+
+// GetInstalledPackages from the RPM database of the sysroot
+func (pm *DnfPackageManager) GetInstalledPackages() ([]string, error) {
+	return pm.queryPackages("rpm", "--root", pm.sysroot.Path, "--query", "--all", "--queryformat", "%{NAME}=%{VERSION}-%{RELEASE}\n")
+}
+
+// GetLibcVersion from the RPM database of the sysroot
+func (pm *DnfPackageManager) GetLibcVersion() string {
+	return pm.queryVersion("rpm", "--root", pm.sysroot.Path, "--query", "--queryformat", "%{VERSION}-%{RELEASE}\n", "glibc")
+}
+
+func (pm *DnfPackageManager) GetHelpFlags() map[string]string {
+	return nil
+}
@@ -0,0 +1,55 @@
+package sysmgr_fixlets
+
+import (
+	"fmt"
+
+	sysmgr_sr "github.com/infra-whizz/sys-mgr/sr"
+)
+
+// Fixlet is a post-transaction fix of a system root content
+type Fixlet interface {
+	// Name of the fixlet, as it is referred in the configuration
+	Name() string
+
+	// Run the fixlet over the system root
+	Run() error
+}
+
+// Registry of all known fixlets by their names
+var registry = map[string]func(sysroot *sysmgr_sr.SysRoot) Fixlet{
+	"resymlink": func(sysroot *sysmgr_sr.SysRoot) Fixlet { return NewReSymlink(sysroot) },
+	"repath":    func(sysroot *sysmgr_sr.SysRoot) Fixlet { return NewRePath(sysroot) },
+}
+
+// DefaultFixlets are running if nothing is configured for a system root
+var DefaultFixlets = []string{"resymlink", "repath"}
+
+// GetFixlet by its name for a given system root
+func GetFixlet(name string, sysroot *sysmgr_sr.SysRoot) (Fixlet, error) {
+	fixlet, ex := registry[name]
+	if !ex {
+		return nil, fmt.Errorf("Unknown fixlet: %s", name)
+	}
+	return fixlet(sysroot), nil
+}
+
+// RunFixlets over the system root in the given order. If names are nil, default fixlets are running.
+func RunFixlets(sysroot *sysmgr_sr.SysRoot, names []string) error {
+	if names == nil {
+		names = DefaultFixlets
+	}
+
+	for _, name := range names {
+		fixlet, err := GetFixlet(name, sysroot)
+		if err != nil {
+			return err
+		}
+
+		sysroot.GetLogger().Debugf("Running fixlet %s on %s", fixlet.Name(), sysroot.Path)
+		if err := fixlet.Run(); err != nil {
+			return fmt.Errorf("Fixlet %s failed: %s", fixlet.Name(), err.Error())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,200 @@
+package sysmgr_fixlets
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	sysmgr_lib "github.com/infra-whizz/sys-mgr/lib"
+	sysmgr_sr "github.com/infra-whizz/sys-mgr/sr"
+	"github.com/karrick/godirwalk"
+)
+
+// Linker scripts are tiny, anything bigger is a real shared object
+const linkerScriptMaxSize = 0x1000
+
+// RePath rewrites absolute paths in pkg-config files, libtool archives and linker scripts,
+// so the cross toolchain does not pick up libraries of the host.
+type RePath struct {
+	sysroot *sysmgr_sr.SysRoot
+	libDirs []string
+	report  []string
+
+	absPath *regexp.Regexp
+}
+
+// NewRePath constructor
+func NewRePath(sysroot *sysmgr_sr.SysRoot) *RePath {
+	rp := new(RePath)
+	rp.sysroot = sysroot
+	rp.libDirs = []string{"lib", "lib64", "usr/lib", "usr/lib64", "usr/share/pkgconfig"}
+	rp.report = []string{}
+
+	// Absolute path, starting a token: not yet "=" or "${pc_sysrootdir}" prefixed and not a comment
+	rp.absPath = regexp.MustCompile(`(^|[\s('"])(-L|-I)?(/[\w.+-][^\s()'"]*)`)
+
+	return rp
+}
+
+// GetReport returns a list of changes, done by the last Rewrite
+func (rp *RePath) GetReport() []string {
+	return rp.report
+}
+
+// inner strips the sysroot path, if it was baked into the file
+func (rp *RePath) inner(pth string) string {
+	if strings.HasPrefix(pth, rp.sysroot.Path+"/") {
+		return pth[len(rp.sysroot.Path):]
+	}
+	return pth
+}
+
+// rewrite all absolute paths on a line, using a given prefix for the sysroot.
+// Flags -I and -L are left to pkg-config, if the prefix is empty.
+func (rp *RePath) rewrite(line string, prefix string) string {
+	return rp.absPath.ReplaceAllStringFunc(line, func(m string) string {
+		sm := rp.absPath.FindStringSubmatch(m)
+		if prefix != "" {
+			return sm[1] + sm[2] + prefix + rp.inner(sm[3])
+		} else if sm[2] != "" {
+			return sm[1] + sm[2] + rp.inner(sm[3])
+		}
+		return sm[1] + "${pc_sysrootdir}" + rp.inner(sm[3])
+	})
+}
+
+// rewritePkgConfig rewrites absolute paths in flags of a .pc file
+func (rp *RePath) rewritePkgConfig(data []byte) []byte {
+	lines := strings.Split(string(data), "\n")
+	for idx, line := range lines {
+		for _, key := range []string{"Libs:", "Libs.private:", "Cflags:", "Cflags.private:"} {
+			if strings.HasPrefix(line, key) {
+				lines[idx] = key + rp.rewrite(line[len(key):], "")
+				break
+			}
+		}
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// rewriteLibtool rewrites absolute paths in dependencies of a .la file
+func (rp *RePath) rewriteLibtool(data []byte) []byte {
+	lines := strings.Split(string(data), "\n")
+	for idx, line := range lines {
+		if strings.HasPrefix(line, "dependency_libs=") {
+			lines[idx] = "dependency_libs=" + rp.rewrite(line[len("dependency_libs="):], "=")
+		}
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// rewriteLinkerScript rewrites absolute paths in a GNU ld script
+func (rp *RePath) rewriteLinkerScript(data []byte) []byte {
+	lines := strings.Split(string(data), "\n")
+	for idx, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "/*") || strings.HasPrefix(trimmed, "*") {
+			continue
+		}
+		lines[idx] = rp.rewrite(line, "=")
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// isLinkerScript checks if a .so file is a text linker script and not an ELF object
+func (rp *RePath) isLinkerScript(data []byte) bool {
+	if bytes.HasPrefix(data, []byte("\x7fELF")) || bytes.IndexByte(data, 0) > -1 {
+		return false
+	}
+	for _, kw := range []string{"GNU ld script", "GROUP", "INPUT"} {
+		if bytes.Contains(data, []byte(kw)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Callback on each dirwalk event
+func (rp *RePath) callback(pathname string, dirEntry *godirwalk.Dirent) error {
+	if !dirEntry.IsRegular() {
+		return nil
+	}
+
+	var fix func([]byte) []byte
+	switch {
+	case strings.HasSuffix(pathname, ".pc"):
+		fix = rp.rewritePkgConfig
+	case strings.HasSuffix(pathname, ".la"):
+		fix = rp.rewriteLibtool
+	case strings.HasSuffix(pathname, ".so"):
+		fix = rp.rewriteLinkerScript
+	default:
+		return nil
+	}
+
+	info, err := os.Stat(pathname)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(pathname, ".so") && info.Size() > linkerScriptMaxSize {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(pathname)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(pathname, ".so") && !rp.isLinkerScript(data) {
+		return nil
+	}
+
+	fixed := fix(data)
+	if bytes.Equal(data, fixed) {
+		return nil
+	}
+
+	if err := sysmgr_lib.WriteFileAtomic(pathname, fixed, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("Unable to rewrite %s: %s", pathname, err.Error())
+	}
+	rp.report = append(rp.report, pathname[len(rp.sysroot.Path):])
+
+	return nil
+}
+
+// Name of the fixlet
+func (rp *RePath) Name() string {
+	return "repath"
+}
+
+// Run the fixlet
+func (rp *RePath) Run() error {
+	return rp.Rewrite()
+}
+
+// Rewrite absolute paths in all library directories of the sysroot
+func (rp *RePath) Rewrite() error {
+	rp.report = []string{}
+	opts := &godirwalk.Options{
+		Callback: rp.callback,
+	}
+
+	for _, d := range rp.libDirs {
+		// Skip missing or symlinked directories, e.g. /lib -> usr/lib on merged-usr systems
+		if info, err := os.Lstat(path.Join(rp.sysroot.Path, d)); err != nil || !info.IsDir() {
+			continue
+		}
+		if err := godirwalk.Walk(path.Join(rp.sysroot.Path, d), opts); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range rp.report {
+		rp.sysroot.GetLogger().Infof("Rewritten absolute paths in %s", f)
+	}
+
+	return nil
+}
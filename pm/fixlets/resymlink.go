@@ -1,21 +1,46 @@
 package sysmgr_fixlets
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
-	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 
+	sysmgr_lib "github.com/infra-whizz/sys-mgr/lib"
 	sysmgr_sr "github.com/infra-whizz/sys-mgr/sr"
 	"github.com/karrick/godirwalk"
+	"golang.org/x/sys/unix"
 )
 
+// ReSymlinkIndex is a persisted index of the sysroot directories with their modification times.
+// Any added, removed or replaced symlink changes mtime of its directory, so unchanged directories are not read again.
+var ReSymlinkIndex string = "/var/cache/sysroot-manager/resymlink.index"
+
+// reSymlinkDir is an indexed directory
+type reSymlinkDir struct {
+	Mtime   int64    `json:"mtime"`
+	Subdirs []string `json:"subdirs"`
+}
+
 // ReSymlink type
 type ReSymlink struct {
 	skipTopDirs []string
 	sysroot     *sysmgr_sr.SysRoot
-	here        string
+	workers     int
+
+	index   map[string]*reSymlinkDir
+	next    map[string]*reSymlinkDir
+	relinks int64
+
+	mtx  sync.Mutex
+	wg   sync.WaitGroup
+	jobs chan string
+	err  error
 }
 
 // NewReSymlink constructor
@@ -23,13 +48,16 @@ func NewReSymlink(sysroot *sysmgr_sr.SysRoot) *ReSymlink {
 	rsl := new(ReSymlink)
 	rsl.sysroot = sysroot
 	rsl.skipTopDirs = []string{"proc", "sys", "dev", "run", "boot", "tmp", "mnt"}
+	rsl.workers = runtime.NumCPU()
 
-	var err error
-	rsl.here, err = os.Getwd()
-	if err != nil {
-		panic("Unable to get current directory: " + err.Error())
-	}
+	return rsl
+}
 
+// SetWorkers sets amount of parallel workers, walking the tree
+func (rsl *ReSymlink) SetWorkers(workers int) *ReSymlink {
+	if workers > 0 {
+		rsl.workers = workers
+	}
 	return rsl
 }
 
@@ -48,44 +76,205 @@ func (rsl *ReSymlink) a2r(pathname string, target string) string {
 	return path.Clean(path.Join(rjump, target))
 }
 
-// Callback on each dirwalk event
-func (rsl *ReSymlink) callback(pathname string, dirEntry *godirwalk.Dirent) error {
+// readlinkat reads a symlink target, relative to the directory descriptor
+func (rsl *ReSymlink) readlinkat(dirfd int, name string) (string, error) {
+	for size := 0x100; ; size *= 2 {
+		buf := make([]byte, size)
+		n, err := unix.Readlinkat(dirfd, name, buf)
+		if err != nil {
+			return "", err
+		}
+		if n < size {
+			return string(buf[:n]), nil
+		}
+	}
+}
+
+// relink a symlink within a directory, if it points to an absolute target.
+// New link is created aside and then atomically renamed over the old one.
+func (rsl *ReSymlink) relink(dirfd int, dirname string, name string) error {
+	pathname := path.Join(dirname, name)
+	brokenPtr, err := rsl.readlinkat(dirfd, name)
+	if err != nil {
+		return fmt.Errorf("Unable to read link %s: %s", pathname, err.Error())
+	}
+
+	if !strings.HasPrefix(brokenPtr, "/") {
+		return nil
+	}
+
+	tmpname := fmt.Sprintf(".%s.resymlink-%d", name, os.Getpid())
+	if err := unix.Symlinkat(rsl.a2r(pathname, brokenPtr), dirfd, tmpname); err != nil {
+		return fmt.Errorf("Symlink error at %s: %s", pathname, err.Error())
+	}
+	if err := unix.Renameat(dirfd, tmpname, dirfd, name); err != nil {
+		unix.Unlinkat(dirfd, tmpname, 0)
+		return fmt.Errorf("Unable to replace link %s: %s", pathname, err.Error())
+	}
+	atomic.AddInt64(&rsl.relinks, 1)
+
+	return nil
+}
+
+// scan a changed directory: relink its symlinks and find subdirectories
+func (rsl *ReSymlink) scan(pathname string) (*reSymlinkDir, error) {
+	dirfd, err := unix.Open(pathname, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open directory %s: %s", pathname, err.Error())
+	}
+	defer unix.Close(dirfd)
+
+	dirents, err := godirwalk.ReadDirents(pathname, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := &reSymlinkDir{Subdirs: []string{}}
+	for _, dirent := range dirents {
+		if dirent.IsSymlink() {
+			if err := rsl.relink(dirfd, pathname, dirent.Name()); err != nil {
+				return nil, err
+			}
+		} else if dirent.IsDir() {
+			dir.Subdirs = append(dir.Subdirs, dirent.Name())
+		}
+	}
+
+	// Relinking itself changes the directory
+	var stat unix.Stat_t
+	if err := unix.Fstat(dirfd, &stat); err != nil {
+		return nil, err
+	}
+	dir.Mtime = stat.Mtim.Nano()
+
+	return dir, nil
+}
+
+// visit a directory and queue its subdirectories. Unchanged directories since the last run are not read.
+func (rsl *ReSymlink) visit(pathname string) error {
 	for _, skipTopDir := range rsl.skipTopDirs {
-		pref := path.Join(rsl.sysroot.Path, skipTopDir)
-		if strings.HasPrefix(pathname, pref) {
-			return filepath.SkipDir
+		if pathname == path.Join(rsl.sysroot.Path, skipTopDir) {
+			return nil
 		}
 	}
 
-	if dirEntry.IsSymlink() {
-		brokenPtr, err := os.Readlink(pathname)
-		if err != nil {
+	info, err := os.Lstat(pathname)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	rel := pathname[len(rsl.sysroot.Path):]
+	rsl.mtx.Lock()
+	dir, ex := rsl.index[rel]
+	rsl.mtx.Unlock()
+
+	if !ex || dir.Mtime != info.ModTime().UnixNano() {
+		if dir, err = rsl.scan(pathname); err != nil {
 			return err
 		}
+	}
 
-		if strings.HasPrefix(brokenPtr, "/") {
-			ptrDir := path.Dir(pathname)
-			if err := os.Chdir(ptrDir); err != nil {
-				return fmt.Errorf("Cannot change directory to %s: %s", ptrDir, err.Error())
-			}
+	rsl.mtx.Lock()
+	rsl.next[rel] = dir
+	rsl.mtx.Unlock()
 
-			if err := os.Remove(pathname); err != nil {
-				return fmt.Errorf("Broken link (%s) removal error: %s", pathname, err.Error())
-			}
+	for _, subdir := range dir.Subdirs {
+		rsl.queue(path.Join(pathname, subdir))
+	}
+
+	return nil
+}
 
-			if err := os.Symlink(rsl.a2r(pathname, brokenPtr), path.Base(pathname)); err != nil {
-				return fmt.Errorf("Symlink error: %s", err.Error())
+// queue a directory for the workers. Full queue is not blocking the worker that is adding to it.
+func (rsl *ReSymlink) queue(pathname string) {
+	rsl.wg.Add(1)
+	select {
+	case rsl.jobs <- pathname:
+	default:
+		go func() { rsl.jobs <- pathname }()
+	}
+}
+
+// worker visits queued directories, until the queue is closed. After the first error the rest is drained.
+func (rsl *ReSymlink) worker() {
+	for pathname := range rsl.jobs {
+		rsl.mtx.Lock()
+		failed := rsl.err != nil
+		rsl.mtx.Unlock()
+
+		if !failed {
+			if err := rsl.visit(pathname); err != nil {
+				rsl.mtx.Lock()
+				if rsl.err == nil {
+					rsl.err = err
+				}
+				rsl.mtx.Unlock()
 			}
 		}
+		rsl.wg.Done()
 	}
+}
 
-	return nil
+// loadIndex of the previous run. Missing or broken index results to a full walk.
+func (rsl *ReSymlink) loadIndex() {
+	rsl.index = map[string]*reSymlinkDir{}
+	data, err := ioutil.ReadFile(path.Join(rsl.sysroot.Path, ReSymlinkIndex))
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(data, &rsl.index); err != nil {
+		rsl.sysroot.GetLogger().Debugf("Discarding symlink index: %s", err.Error())
+		rsl.index = map[string]*reSymlinkDir{}
+	}
+}
+
+// saveIndex for the next run
+func (rsl *ReSymlink) saveIndex() error {
+	data, err := json.Marshal(rsl.next)
+	if err != nil {
+		return err
+	}
+
+	indexPath := path.Join(rsl.sysroot.Path, ReSymlinkIndex)
+	if err := os.MkdirAll(path.Dir(indexPath), 0755); err != nil {
+		return err
+	}
+
+	return sysmgr_lib.WriteFileAtomic(indexPath, data, 0644)
 }
 
 // Relink absolute symlinks to relative
 func (rsl *ReSymlink) Relink() error {
-	opts := &godirwalk.Options{
-		Callback: rsl.callback,
+	rsl.loadIndex()
+	rsl.next = map[string]*reSymlinkDir{}
+	rsl.relinks = 0
+	rsl.err = nil
+	rsl.jobs = make(chan string, rsl.workers*0x100)
+
+	for i := 0; i < rsl.workers; i++ {
+		go rsl.worker()
 	}
-	return godirwalk.Walk(rsl.sysroot.Path, opts)
+	rsl.queue(rsl.sysroot.Path)
+	rsl.wg.Wait()
+	close(rsl.jobs)
+
+	if rsl.err != nil {
+		return rsl.err
+	}
+	rsl.sysroot.GetLogger().Debugf("Relinked %d symlinks, %d directories indexed", rsl.relinks, len(rsl.next))
+
+	return rsl.saveIndex()
+}
+
+// Name of the fixlet
+func (rsl *ReSymlink) Name() string {
+	return "resymlink"
+}
+
+// Run the fixlet
+func (rsl *ReSymlink) Run() error {
+	return rsl.Relink()
 }
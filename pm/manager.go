@@ -19,11 +19,23 @@ type PackageManager interface {
 	// SetSysroot to the package manager and lock on it
 	SetSysroot(sysroot *sysmgr_sr.SysRoot) PackageManager
 
+	// SetFixlets to run after transactions, changing the system root. Nil means default fixlets.
+	SetFixlets(fixlets []string) PackageManager
+
 	// Setup package manager, once sysroot is given. This will write required configurations
 	Setup() error
 
 	// Extract help flags to override package manager
 	GetHelpFlags() map[string]string
+
+	// IsMutating returns true, if the command changes the system root, rather than only queries it
+	IsMutating(args ...string) bool
+
+	// GetLibcVersion returns version of the glibc package in the sysroot, or an empty string if it is not installed
+	GetLibcVersion() string
+
+	// GetInstalledPackages returns a list of all packages in the sysroot, as "name=version"
+	GetInstalledPackages() ([]string, error)
 }
 
 // StdProcessStream is just a generic pipe to the STDOUT and nothing else at this time
@@ -56,6 +68,8 @@ func GetCurrentPackageManager() PackageManager {
 		pkgman = NewAptPackageManager()
 	case "opensuse-leap":
 		pkgman = NewZypperPackageManager()
+	case "fedora", "rhel", "centos", "rocky", "almalinux":
+		pkgman = NewDnfPackageManager()
 	default:
 		os.Stderr.WriteString(fmt.Sprintf("The '%s' platform is not supported. :-(\n", platform))
 		os.Exit(1)
@@ -7,14 +7,12 @@ import (
 	"path"
 	"strings"
 
-	sysmgr_fixlets "github.com/infra-whizz/sys-mgr/pm/fixlets"
 	sysmgr_sr "github.com/infra-whizz/sys-mgr/sr"
 )
 
 // ZypperPackageManager object
 type ZypperPackageManager struct {
 	sysroot *sysmgr_sr.SysRoot
-	archFix map[string]string
 
 	BasePackageManager
 }
@@ -22,8 +20,9 @@ type ZypperPackageManager struct {
 // NewZypperPackageManager creates a zypper caller object
 func NewZypperPackageManager() *ZypperPackageManager {
 	pm := new(ZypperPackageManager)
-	pm.archFix = map[string]string{"arm": "armv7hl"}
 	pm.env = make(map[string]string)
+	pm.mutating = []string{"install", "in", "remove", "rm", "update", "up", "dist-upgrade", "dup", "patch",
+		"install-new-recommends", "inr", "verify", "ve"}
 	return pm
 }
 
@@ -38,8 +37,7 @@ func (pm *ZypperPackageManager) Call(args ...string) error {
 		return err
 	}
 
-	// Run symlink fixlet after each Zypper call
-	return sysmgr_fixlets.NewReSymlink(pm.sysroot).Relink()
+	return pm.afterTransaction(pm.sysroot, pm.GetLibcVersion, args[2:]...)
 }
 
 // Name of the package manager
@@ -56,6 +54,12 @@ func (pm *ZypperPackageManager) SetSysroot(sysroot *sysmgr_sr.SysRoot) PackageMa
 	return pm
 }
 
+// SetFixlets to run after transactions
+func (pm *ZypperPackageManager) SetFixlets(fixlets []string) PackageManager {
+	pm.fixlets = fixlets
+	return pm
+}
+
 // Setup package manager
 func (pm *ZypperPackageManager) Setup() error {
 	zyppConf := path.Join(pm.sysroot.Path, "/etc/zypp")
@@ -66,12 +70,8 @@ func (pm *ZypperPackageManager) Setup() error {
 	}
 	zyppConf = path.Join(zyppConf, "zypp.conf")
 
-	// Fix arch names
-	arch, ex := pm.archFix[pm.sysroot.Arch]
-	if !ex {
-		arch = pm.sysroot.Arch
-		pm.sysroot.GetLogger().Infof("Setting default architecture to Zypper: %s", arch)
-	}
+	arch := sysmgr_sr.GetArchNames(pm.sysroot.Arch).Rpm
+	pm.sysroot.GetLogger().Debugf("Setting architecture to Zypper: %s", arch)
 
 	var buff strings.Builder
 	buff.WriteString("[main]\n")
@@ -82,6 +82,16 @@ func (pm *ZypperPackageManager) Setup() error {
 	return ioutil.WriteFile(zyppConf, []byte(buff.String()), 0644)
 }
 
+// GetInstalledPackages from the RPM database of the sysroot
+func (pm *ZypperPackageManager) GetInstalledPackages() ([]string, error) {
+	return pm.queryPackages("rpm", "--root", pm.sysroot.Path, "--query", "--all", "--queryformat", "%{NAME}=%{VERSION}-%{RELEASE}\n")
+}
+
+// GetLibcVersion from the RPM database of the sysroot
+func (pm *ZypperPackageManager) GetLibcVersion() string {
+	return pm.queryVersion("rpm", "--root", pm.sysroot.Path, "--query", "--queryformat", "%{VERSION}-%{RELEASE}\n", "glibc")
+}
+
 func (pm *ZypperPackageManager) GetHelpFlags() map[string]string {
 	return nil
 }
@@ -0,0 +1,153 @@
+package sysmgr_sr
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-yaml/yaml"
+	sysmgr_lib "github.com/infra-whizz/sys-mgr/lib"
+	wzlib_subprocess "github.com/infra-whizz/wzlib/subprocess"
+)
+
+// Name of the manifest within the sysroot archive
+var ArchiveManifest string = "sysroot.manifest"
+
+// Directory of the system root tree within the archive
+var ArchiveRootfs string = "rootfs"
+
+// SysrootManifest describes an exported system root
+type SysrootManifest struct {
+	Name     string    `yaml:"name"`
+	Arch     string    `yaml:"arch"`
+	Distro   string    `yaml:"distro"`
+	Version  string    `yaml:"version"`
+	Created  time.Time `yaml:"created"`
+	Packages []string  `yaml:"packages"`
+}
+
+// getCompression returns tar compression option, based on the archive file name. Default is zstd.
+func (srm *SysrootManager) getCompression(archive string) string {
+	for _, ext := range []string{".xz", ".txz"} {
+		if strings.HasSuffix(archive, ext) {
+			return "--xz"
+		}
+	}
+	return "--zstd"
+}
+
+// ExportSysRoot packs a system root with its manifest into a compressed tarball
+func (srm *SysrootManager) ExportSysRoot(name string, arch string, archive string, packages []string) error {
+	if err := srm.checkArch(arch); err != nil {
+		return err
+	}
+
+	sysroot, err := NewSysRoot(srm.sysroots).SetName(name).SetArch(arch).Init()
+	if err != nil {
+		return err
+	}
+
+	if err := sysroot.UmountBinds(); err != nil {
+		return err
+	}
+
+	release := sysroot.GetOSRelease()
+	data, err := yaml.Marshal(&SysrootManifest{
+		Name:     sysroot.Name,
+		Arch:     sysroot.Arch,
+		Distro:   release["ID"],
+		Version:  release["VERSION_ID"],
+		Created:  time.Now(),
+		Packages: packages,
+	})
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempDir("", "sysroot-export-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := ioutil.WriteFile(path.Join(tmp, ArchiveManifest), data, 0644); err != nil {
+		return err
+	}
+
+	srm.GetLogger().Infof("Exporting %s (%s) to %s", sysroot.Name, sysroot.Arch, archive)
+
+	return sysmgr_lib.LoggedExec("tar", "--create", "--file", archive, srm.getCompression(archive),
+		"--xattrs", "--xattrs-include=*", "--acls", "--numeric-owner", "--one-file-system",
+		"--transform", fmt.Sprintf("s,^\\.,%s,", ArchiveRootfs),
+		"-C", tmp, ArchiveManifest, "-C", sysroot.Path, ".")
+}
+
+// GetArchiveManifest reads the manifest of an exported system root
+func (srm *SysrootManager) GetArchiveManifest(archive string) (*SysrootManifest, error) {
+	if _, err := os.Stat(archive); err != nil {
+		return nil, err
+	}
+
+	data, err := wzlib_subprocess.ExecCommand("tar", "--extract", "--file", archive, "--to-stdout", ArchiveManifest).Output()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read manifest from %s: %s", archive, err.Error())
+	}
+
+	manifest := &SysrootManifest{}
+	if err := yaml.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("Invalid manifest in %s: %s", archive, err.Error())
+	}
+
+	if manifest.Name == "" || manifest.Arch == "" {
+		return nil, fmt.Errorf("Manifest in %s has no name or architecture", archive)
+	}
+
+	return manifest, nil
+}
+
+// ImportSysRoot unpacks previously exported system root. If name is empty, the one from the manifest is used.
+// Imported system root is never a default one.
+func (srm *SysrootManager) ImportSysRoot(archive string, name string) (*SysRoot, error) {
+	manifest, err := srm.GetArchiveManifest(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := srm.checkArch(manifest.Arch); err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		name = manifest.Name
+	}
+	if strings.ContainsAny(name, "./ ") {
+		return nil, fmt.Errorf("Invalid name of the imported system root: '%s'", name)
+	}
+
+	target := path.Join(srm.sysroots, fmt.Sprintf("%s.%s", name, manifest.Arch))
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		return nil, fmt.Errorf("System root at %s already exists", target)
+	}
+
+	if err := sysmgr_lib.MakeTreeRoot(target); err != nil {
+		return nil, err
+	}
+
+	srm.GetLogger().Infof("Importing %s (%s) from %s", name, manifest.Arch, archive)
+	if err := sysmgr_lib.LoggedExec("tar", "--extract", "--file", archive, "--xattrs", "--xattrs-include=*", "--acls",
+		"--numeric-owner", "--same-permissions", "-C", target, "--strip-components=1", ArchiveRootfs); err != nil {
+		sysmgr_lib.RemoveTree(target)
+		return nil, err
+	}
+
+	// Configuration might belong to a different name or be a default
+	sysroot := NewSysRoot(srm.sysroots).SetName(name).SetArch(manifest.Arch)
+	if err := sysroot.SetDefault(false); err != nil {
+		return nil, err
+	}
+
+	return sysroot.Init()
+}
@@ -0,0 +1,31 @@
+package sysmgr_sr
+
+// ArchNames are names of an architecture, as different tools know it
+type ArchNames struct {
+	Dpkg string
+	Rpm  string
+	Oci  string
+	Qemu string
+}
+
+// Registered names by architecture. These are set from the architecture definitions at the start.
+var archNames = map[string]*ArchNames{}
+
+// SetArchNames registers tool-specific names of an architecture
+func SetArchNames(arch string, names *ArchNames) {
+	archNames[arch] = names
+}
+
+// GetArchNames returns tool-specific names of an architecture. Names, which are not known, are the same as the architecture.
+func GetArchNames(arch string) *ArchNames {
+	names := &ArchNames{Dpkg: arch, Rpm: arch, Oci: arch, Qemu: arch}
+	if known, ex := archNames[arch]; ex {
+		for _, name := range [][2]*string{{&names.Dpkg, &known.Dpkg}, {&names.Rpm, &known.Rpm},
+			{&names.Oci, &known.Oci}, {&names.Qemu, &known.Qemu}} {
+			if *name[1] != "" {
+				*name[0] = *name[1]
+			}
+		}
+	}
+	return names
+}
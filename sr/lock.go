@@ -0,0 +1,105 @@
+package sysmgr_sr
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"golang.org/x/sys/unix"
+)
+
+// Directory within the system roots, where all the lock files are kept
+var LocksDir string = ".locks"
+
+// SysrootLock is an advisory file lock on all or a particular system root
+type SysrootLock struct {
+	fh   *os.File
+	path string
+}
+
+// Unlock and release the lock file. Nil lock is a no-op.
+func (l *SysrootLock) Unlock() error {
+	if l == nil || l.fh == nil {
+		return nil
+	}
+	defer l.fh.Close()
+	return unix.Flock(int(l.fh.Fd()), unix.LOCK_UN)
+}
+
+// SetLockWait sets a policy to wait for a lock, if it is taken by another process, or fail immediately
+func (srm *SysrootManager) SetLockWait(wait bool) *SysrootManager {
+	srm.lockNoWait = !wait
+	return srm
+}
+
+// lock takes an advisory lock on a lock file by its id, waiting for it or failing immediately.
+// If system roots directory is not there (e.g. chrooted), or lock file cannot be created
+// due to permissions, nothing is locked.
+func (srm *SysrootManager) lock(id string, exclusive bool, wait bool) (*SysrootLock, error) {
+	if _, err := os.Stat(srm.sysroots); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	l := &SysrootLock{path: path.Join(srm.sysroots, LocksDir, fmt.Sprintf("%s.lock", id))}
+
+	var err error
+	if err = os.MkdirAll(path.Dir(l.path), 0755); err == nil {
+		l.fh, err = os.OpenFile(l.path, os.O_RDONLY|os.O_CREATE, 0644)
+	}
+	if err != nil {
+		if !os.IsPermission(err) {
+			return nil, fmt.Errorf("Unable to open lock file %s: %s", l.path, err.Error())
+		}
+		// Unprivileged callers can still lock an existing file, as flock needs no write access
+		if l.fh, err = os.Open(l.path); err != nil {
+			srm.GetLogger().Debugf("Skipping lock on %s: %s", l.path, err.Error())
+			return nil, nil
+		}
+	}
+
+	how := unix.LOCK_SH
+	if exclusive {
+		how = unix.LOCK_EX
+	}
+	if !wait {
+		how |= unix.LOCK_NB
+	}
+
+	srm.GetLogger().Debugf("Locking %s (exclusive: %v)", l.path, exclusive)
+	for {
+		err = unix.Flock(int(l.fh.Fd()), how)
+		if err != unix.EINTR {
+			break
+		}
+	}
+	if err != nil {
+		l.fh.Close()
+		if err == unix.EWOULDBLOCK {
+			return nil, fmt.Errorf("System root is locked by another process (%s)", l.path)
+		}
+		return nil, fmt.Errorf("Unable to lock %s: %s", l.path, err.Error())
+	}
+
+	return l, nil
+}
+
+// LockGlobal takes a lock on the whole set of system roots.
+// Exclusive lock is needed for operations, touching more than one system root, such as setting a default one.
+func (srm *SysrootManager) LockGlobal(exclusive bool) (*SysrootLock, error) {
+	return srm.lock("global", exclusive, !srm.lockNoWait)
+}
+
+// TryLockGlobal takes a lock on the whole set of system roots, failing immediately, if it is taken
+func (srm *SysrootManager) TryLockGlobal(exclusive bool) (*SysrootLock, error) {
+	return srm.lock("global", exclusive, false)
+}
+
+// LockSysroot takes a lock on a particular system root
+func (srm *SysrootManager) LockSysroot(name string, arch string, exclusive bool) (*SysrootLock, error) {
+	return srm.lock(fmt.Sprintf("%s.%s", name, arch), exclusive, !srm.lockNoWait)
+}
+
+// TryLockSysroot takes a lock on a particular system root, failing immediately, if it is taken
+func (srm *SysrootManager) TryLockSysroot(name string, arch string, exclusive bool) (*SysrootLock, error) {
+	return srm.lock(fmt.Sprintf("%s.%s", name, arch), exclusive, false)
+}
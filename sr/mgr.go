@@ -7,6 +7,7 @@ import (
 	"path"
 	"strings"
 
+	sysmgr_lib "github.com/infra-whizz/sys-mgr/lib"
 	wzlib_logger "github.com/infra-whizz/wzlib/logger"
 	"github.com/isbm/go-nanoconf"
 	"github.com/thoas/go-funk"
@@ -16,9 +17,14 @@ var DefaultSysrootPath string = "/usr/sysroots"
 var HostSysrootConfig string = "/etc/sysroots.conf"
 var ChildSysrootConfig string = "/etc/sysroot.conf"
 
+// Environment variable to select a system root per a call, as "name.arch"
+var SysrootEnv string = "SYSROOT"
+
 type SysrootManager struct {
 	sysroots      string
 	architectures []string
+	lockNoWait    bool
+	fixlets       map[string][]string
 	wzlib_logger.WzLogger
 }
 
@@ -29,9 +35,47 @@ func NewSysrootManager(conf *nanoconf.Config) *SysrootManager {
 		srm.sysroots = DefaultSysrootPath
 	}
 	srm.architectures = []string{}
+	srm.fixlets = srm.loadFixlets(conf.Root().Raw()["fixlets"])
 	return srm
 }
 
+// loadFixlets configuration, which is a map of "name.arch" (or "default") to a list of fixlet names
+func (srm *SysrootManager) loadFixlets(section interface{}) map[string][]string {
+	fixlets := map[string][]string{}
+	cfg, ok := section.(map[interface{}]interface{})
+	if !ok {
+		return fixlets
+	}
+
+	for id, names := range cfg {
+		fixlets[fmt.Sprintf("%v", id)] = []string{}
+		if names, ok := names.([]interface{}); ok {
+			for _, name := range names {
+				fixlets[fmt.Sprintf("%v", id)] = append(fixlets[fmt.Sprintf("%v", id)], fmt.Sprintf("%v", name))
+			}
+		}
+	}
+
+	return fixlets
+}
+
+// GetFixlets returns configured fixlet names for a system root, falling back to the "default" entry.
+// If nothing is configured, nil is returned.
+func (srm *SysrootManager) GetFixlets(sysroot *SysRoot) []string {
+	if names, ex := srm.fixlets[fmt.Sprintf("%s.%s", sysroot.Name, sysroot.Arch)]; ex {
+		return names
+	}
+	if names, ex := srm.fixlets["default"]; ex {
+		return names
+	}
+	return nil
+}
+
+// GetSysrootsPath returns a path where all system roots are placed
+func (srm *SysrootManager) GetSysrootsPath() string {
+	return srm.sysroots
+}
+
 // SetSupported Architectures
 func (srm *SysrootManager) SetSupportedArchitectures(architectures []string) *SysrootManager {
 	srm.architectures = architectures
@@ -61,6 +105,21 @@ func (srm *SysrootManager) CreateSysRoot(name string, arch string) (*SysRoot, er
 	return sysroot, nil
 }
 
+// CreateSysRootFromOCI creates a system root from the local OCI image layout or saved Docker image
+func (srm *SysrootManager) CreateSysRootFromOCI(name string, arch string, image string) (*SysRoot, error) {
+	if err := srm.checkArch(arch); err != nil {
+		return nil, err
+	}
+
+	srm.GetLogger().Debugf("Placing sysroot from %s into %s", image, srm.sysroots)
+
+	sysroot := NewSysRoot(srm.sysroots).SetName(name).SetArch(arch)
+	if err := sysroot.SetProvisioner(NewOciSysrootProvisioner(name, arch, srm.sysroots, image)).Create(); err != nil {
+		return nil, err
+	}
+	return sysroot, nil
+}
+
 // CheckWithinSysroot returns an error, if current working directory is within sysroot.
 // Useful to prevent destructive operations, such as sysroot removal, while still working in it.
 func (srm SysrootManager) CheckWithinSysroot(sysroot *SysRoot) error {
@@ -98,6 +157,94 @@ func (srm *SysrootManager) DeleteSysRoot(name string, arch string) error {
 	return sysroot.Delete()
 }
 
+// CloneSysRoot copies the entire system root under a new name. The clone is never a default one.
+func (srm *SysrootManager) CloneSysRoot(name string, arch string, to string) (*SysRoot, error) {
+	if err := srm.checkArch(arch); err != nil {
+		return nil, err
+	}
+
+	if to == "" || strings.ContainsAny(to, "./ ") {
+		return nil, fmt.Errorf("Invalid name of the system root clone: '%s'", to)
+	}
+
+	sysroot, err := NewSysRoot(srm.sysroots).SetName(name).SetArch(arch).Init()
+	if err != nil {
+		return nil, err
+	}
+
+	// Bound runtime directories would be copied as well
+	if err := sysroot.CheckUnbound(); err != nil {
+		return nil, err
+	}
+
+	clone := NewSysRoot(srm.sysroots).SetName(to).SetArch(sysroot.Arch)
+	target := path.Join(srm.sysroots, fmt.Sprintf("%s.%s", clone.Name, clone.Arch))
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		return nil, fmt.Errorf("System root at %s already exists", target)
+	}
+
+	srm.GetLogger().Infof("Cloning %s (%s) to %s", sysroot.Name, sysroot.Arch, clone.Name)
+	if _, err := srm.snapshotTree(sysroot.Path, target); err != nil {
+		sysmgr_lib.RemoveTree(target)
+		return nil, err
+	}
+
+	if err := clone.SetDefault(false); err != nil {
+		return nil, err
+	}
+
+	return clone.Init()
+}
+
+// RenameSysRoot renames the system root directory and its configuration. Default flag is kept as is.
+func (srm *SysrootManager) RenameSysRoot(name string, arch string, to string) (*SysRoot, error) {
+	if err := srm.checkArch(arch); err != nil {
+		return nil, err
+	}
+
+	if to == "" || strings.ContainsAny(to, "./ ") {
+		return nil, fmt.Errorf("Invalid new name of the system root: '%s'", to)
+	}
+
+	sysroot, err := NewSysRoot(srm.sysroots).SetName(name).SetArch(arch).Init()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := srm.CheckWithinSysroot(sysroot); err != nil {
+		return nil, err
+	}
+
+	renamed := NewSysRoot(srm.sysroots).SetName(to).SetArch(sysroot.Arch)
+	target := path.Join(srm.sysroots, fmt.Sprintf("%s.%s", renamed.Name, renamed.Arch))
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		return nil, fmt.Errorf("System root at %s already exists", target)
+	}
+
+	if err := sysroot.UmountBinds(); err != nil {
+		return nil, err
+	}
+
+	srm.GetLogger().Infof("Renaming %s (%s) to %s", sysroot.Name, sysroot.Arch, renamed.Name)
+	if err := os.Rename(sysroot.Path, target); err != nil {
+		return nil, err
+	}
+
+	if err := renamed.SetDefault(sysroot.Default); err != nil {
+		return nil, err
+	}
+
+	// Snapshots follow the system root
+	snapshots := srm.getSnapshotsPath(sysroot.Name, sysroot.Arch)
+	if _, err := os.Stat(snapshots); err == nil {
+		if err := os.Rename(snapshots, srm.getSnapshotsPath(renamed.Name, renamed.Arch)); err != nil {
+			return nil, err
+		}
+	}
+
+	return renamed.Init()
+}
+
 // SetDefaultSysRoot to be locked on the particular package manager.
 // This option only sets configured default sysroot, but it still can be overridden.
 func (srm *SysrootManager) SetDefaultSysRoot(name string, arch string) error {
@@ -138,6 +285,10 @@ func (srm *SysrootManager) GetSysRoots() ([]*SysRoot, error) {
 
 	roots := []*SysRoot{}
 	for _, fn := range data {
+		if strings.HasPrefix(fn.Name(), ".") {
+			continue // Snapshots and other service data
+		}
+
 		na := strings.Split(fn.Name(), ".")
 		if len(na) != 2 {
 			return nil, fmt.Errorf("Unknown sysroot found at %s", path.Join(srm.sysroots, fn.Name()))
@@ -179,6 +330,41 @@ func (srm *SysrootManager) GetDefaultSysroot() (*SysRoot, error) {
 	return nil, fmt.Errorf("No default system root has been found. Please setup one.")
 }
 
+// GetSysroot returns a system root by its "name.arch" identifier
+func (srm *SysrootManager) GetSysroot(id string) (*SysRoot, error) {
+	na := strings.Split(id, ".")
+	if len(na) != 2 || na[0] == "" || na[1] == "" {
+		return nil, fmt.Errorf("Invalid system root identifier '%s', should be as 'name.arch'", id)
+	}
+
+	if err := srm.checkArch(na[1]); err != nil {
+		return nil, err
+	}
+
+	return NewSysRoot(srm.sysroots).SetName(na[0]).SetArch(na[1]).Init()
+}
+
+// GetSelectedSysroot returns a system root by its "name.arch" identifier.
+// If identifier is empty, it is taken from the environment, otherwise the default one is returned.
+// Chrooted environment has always only the current system root.
+func (srm *SysrootManager) GetSelectedSysroot(id string) (*SysRoot, error) {
+	if id == "" {
+		id = os.Getenv(SysrootEnv)
+	}
+
+	if id != "" {
+		isChrooted, err := srm.IsChrooted()
+		if err != nil {
+			return nil, fmt.Errorf("Unable to determine the chroot environment: %s", err.Error())
+		}
+		if !isChrooted {
+			return srm.GetSysroot(id)
+		}
+	}
+
+	return srm.GetDefaultSysroot()
+}
+
 // fileExists or not. This needs to be moved to utils, but importing them causes cycle.
 // Utils needs to be moved into a separate sub-package.
 func (srm *SysrootManager) fileExists(filepath string) (bool, error) {
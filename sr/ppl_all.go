@@ -2,23 +2,27 @@ package sysmgr_sr
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
 	"syscall"
+	"time"
 
+	sysmgr_lib "github.com/infra-whizz/sys-mgr/lib"
 	wzlib_logger "github.com/infra-whizz/wzlib/logger"
 	wzlib_traits "github.com/infra-whizz/wzlib/traits"
 	"github.com/isbm/go-shutil"
+	"golang.org/x/sys/unix"
 )
 
 type BaseSysrootProvisioner struct {
-	qemuPattern string
 	qemuPath    string
 	name        string
 	arch        string
 	sysrootPath string
 	sysPath     string // Path of the root
 	confPath    string
+	kind        string // Type of the provisioner
 
 	sysinfo *wzlib_traits.WzTraitsContainer
 
@@ -92,7 +96,13 @@ func (dsp *BaseSysrootProvisioner) Populate() error {
 		return err
 	}
 
+	// Implementations may already write into the tree before populating it
+	if err := sysmgr_lib.MakeTreeRoot(dsp.sysrootPath); err != nil {
+		return err
+	}
+
 	if err := dsp.ref.beforePopulate(); err != nil {
+		sysmgr_lib.RemoveTree(dsp.sysrootPath)
 		return err
 	}
 
@@ -148,3 +158,47 @@ func (dsp *BaseSysrootProvisioner) replicate() error {
 func (dsp *BaseSysrootProvisioner) GetConfigPath() string {
 	return dsp.confPath
 }
+
+// GetType of the provisioner, e.g. "debian" or "zypper"
+func (dsp *BaseSysrootProvisioner) GetType() string {
+	return dsp.kind
+}
+
+// writeConfig creates initial configuration of the system root
+func (dsp *BaseSysrootProvisioner) writeConfig() error {
+	return sysmgr_lib.WriteFileAtomic(dsp.confPath, []byte(fmt.Sprintf("name: %s\narch: %s\ndefault: false\nprovisioner: %s\ncreated: %s\n",
+		dsp.name, dsp.arch, dsp.kind, time.Now().Format(time.RFC3339))), 0644)
+}
+
+// mountBinds of the runtime directories from the host into the system root
+func (dsp *BaseSysrootProvisioner) mountBinds() error {
+	dsp.GetLogger().Info("Activating system root")
+	for _, src := range []string{"/proc", "/sys", "/dev", "/run"} {
+		dst := path.Join(dsp.sysrootPath, src)
+		dsp.GetLogger().Debugf("Mounting %s to %s", src, dst)
+		if err := syscall.Mount(src, dst, "", syscall.MS_BIND, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// umountBinds of the runtime directories
+func (dsp *BaseSysrootProvisioner) umountBinds() error {
+	// pre-umount, if anything
+	for _, d := range []string{"/proc", "/dev", "/sys", "/run"} {
+		d = path.Join(dsp.sysrootPath, d)
+		if err := syscall.Unmount(d, syscall.MNT_DETACH|syscall.MNT_FORCE|unix.UMOUNT_NOFOLLOW); err != nil {
+			dsp.GetLogger().Warnf("Unable to unmount %s", d)
+		}
+		files, err := ioutil.ReadDir(d)
+		if err != nil {
+			return err
+		}
+		if len(files) > 0 {
+			return fmt.Errorf("Failed to unmount %s. Please umount it manually.", d)
+		}
+	}
+
+	return nil
+}
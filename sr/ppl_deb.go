@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path"
 	"sort"
 	"strings"
@@ -30,13 +29,13 @@ type DebianSysrootProvisioner struct {
 
 func NewDebianSysrootProvisioner(name, arch, root string) *DebianSysrootProvisioner {
 	dsp := new(DebianSysrootProvisioner)
-	dsp.qemuPattern = "qemu-%s-static"
+	dsp.kind = "debian"
 
 	dsp.SetArch(arch)
 	dsp.SetName(name)
 	dsp.SetSysPath(root)
 
-	dsp.qemuPath, _ = exec.LookPath(fmt.Sprintf(dsp.qemuPattern, dsp.arch))
+	dsp.qemuPath, _ = sysmgr_lib.FindQemu(GetArchNames(dsp.arch).Qemu, true)
 	dsp.ref = dsp
 
 	dsp.sysinfo = wzlib_traits.NewWzTraitsContainer()
@@ -65,7 +64,7 @@ func (dsp *DebianSysrootProvisioner) getSysPath() string {
 
 func (dsp *DebianSysrootProvisioner) beforePopulate() error {
 	if dsp.getQemuPath() == "" {
-		return fmt.Errorf("No static QEMU found: %s", fmt.Sprintf(dsp.qemuPattern, dsp.arch))
+		return fmt.Errorf("No static QEMU found for %s architecture", dsp.arch)
 	}
 
 	return nil
@@ -125,16 +124,7 @@ func (dsp *DebianSysrootProvisioner) getRepoData() (*repodata, error) {
 }
 
 func (dsp *DebianSysrootProvisioner) GetArch() string {
-	archfix := map[string]string{
-		"x86_64": "amd64",
-		"i586":   "i386",
-	}
-	arch, ex := archfix[dsp.arch]
-	if !ex {
-		arch = dsp.arch
-	}
-
-	return arch
+	return GetArchNames(dsp.arch).Dpkg
 }
 
 // Populate sysroot according to the current package manager specifics
@@ -167,8 +157,7 @@ func (dsp *DebianSysrootProvisioner) afterPopulate() error {
 		}
 	}
 
-	// Create sysroot configuration
-	if err := ioutil.WriteFile(dsp.confPath, []byte(fmt.Sprintf("name: %s\narch: %s\ndefault: false\n", dsp.name, dsp.arch)), 0644); err != nil {
+	if err := dsp.writeConfig(); err != nil {
 		return err
 	}
 
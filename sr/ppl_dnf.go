@@ -0,0 +1,119 @@
+package sysmgr_sr
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	sysmgr_lib "github.com/infra-whizz/sys-mgr/lib"
+	wzlib_traits "github.com/infra-whizz/wzlib/traits"
+	wzlib_traits_attributes "github.com/infra-whizz/wzlib/traits/attributes"
+	wzlib_utils "github.com/infra-whizz/wzlib/utils"
+	"github.com/isbm/go-shutil"
+)
+
+// DnfSysrootProvisioner bootstraps Fedora/RHEL family system roots
+type DnfSysrootProvisioner struct {
+	BaseSysrootProvisioner
+	releasever string
+}
+
+func NewDnfSysrootProvisioner(name, arch, root string) *DnfSysrootProvisioner {
+	dsp := new(DnfSysrootProvisioner)
+	dsp.kind = "dnf"
+
+	dsp.SetArch(arch)
+	dsp.SetName(name)
+	dsp.SetSysPath(root)
+
+	dsp.qemuPath, _ = sysmgr_lib.FindQemu(GetArchNames(dsp.arch).Qemu, true)
+	dsp.ref = dsp
+
+	dsp.sysinfo = wzlib_traits.NewWzTraitsContainer()
+	wzlib_traits_attributes.NewSysInfo().Load(dsp.sysinfo)
+
+	return dsp
+}
+
+func (dsp *DnfSysrootProvisioner) Activate() error {
+	return dsp.mountBinds()
+}
+
+func (dsp *DnfSysrootProvisioner) UnmountBinds() error {
+	return dsp.umountBinds()
+}
+
+func (dsp *DnfSysrootProvisioner) getQemuPath() string {
+	return dsp.qemuPath
+}
+
+func (dsp *DnfSysrootProvisioner) getSysPath() string {
+	return dsp.sysPath
+}
+
+// GetArch returns an architecture name, as RPM knows it
+func (dsp *DnfSysrootProvisioner) GetArch() string {
+	return GetArchNames(dsp.arch).Rpm
+}
+
+func (dsp *DnfSysrootProvisioner) beforePopulate() error {
+	if dsp.getQemuPath() == "" {
+		return fmt.Errorf("No static QEMU found for %s architecture", dsp.arch)
+	}
+
+	dsp.releasever = fmt.Sprintf("%v", dsp.sysinfo.Get("os.ver_major"))
+	if dsp.releasever == "" || dsp.releasever == "<nil>" {
+		return fmt.Errorf("Unable to determine release version of the host")
+	}
+
+	return nil
+}
+
+// Populate sysroot with a minimal set of packages, using repositories of the host
+func (dsp *DnfSysrootProvisioner) onPopulate() error {
+	dsp.GetLogger().Debugf("Populating sysroot into %s", dsp.sysrootPath)
+
+	for _, d := range []string{"/etc/yum.repos.d", "/etc/dnf/vars"} {
+		if err := os.MkdirAll(path.Join(dsp.sysrootPath, d), 0755); err != nil {
+			return err
+		}
+	}
+
+	// Repositories are taken from the host, as they are usually arch-agnostic via $basearch
+	repos, err := filepath.Glob("/etc/yum.repos.d/*.repo")
+	if err != nil {
+		return err
+	}
+	for _, repo := range repos {
+		target := path.Join(dsp.sysrootPath, repo)
+		dsp.GetLogger().Debugf("Copying %s to %s", repo, target)
+		if err := shutil.CopyFile(repo, target, false); err != nil {
+			return err
+		}
+	}
+
+	if err := ioutil.WriteFile(path.Join(dsp.sysrootPath, "/etc/dnf/vars/releasever"), []byte(dsp.releasever+"\n"), 0644); err != nil {
+		return err
+	}
+
+	return sysmgr_lib.LoggedExec("dnf", "--installroot", dsp.sysrootPath, "--forcearch", dsp.GetArch(),
+		"--releasever", dsp.releasever, fmt.Sprintf("--setopt=reposdir=%s", path.Join(dsp.sysrootPath, "/etc/yum.repos.d")),
+		"--setopt=install_weak_deps=False", "--assumeyes", "install", "filesystem", "glibc", "rpm", "dnf")
+}
+
+func (dsp *DnfSysrootProvisioner) afterPopulate() error {
+	for _, d := range []string{"/etc", "/proc", "/dev", "/sys", "/run", "/tmp"} {
+		tp := path.Join(dsp.sysrootPath, d)
+		if wzlib_utils.FileExists(tp) {
+			continue
+		}
+
+		if err := os.MkdirAll(tp, 0755); err != nil {
+			return err
+		}
+	}
+
+	return dsp.writeConfig()
+}
@@ -0,0 +1,484 @@
+package sysmgr_sr
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	sysmgr_lib "github.com/infra-whizz/sys-mgr/lib"
+	wzlib_utils "github.com/infra-whizz/wzlib/utils"
+	"golang.org/x/sys/unix"
+)
+
+// Whiteout markers of the OCI image layers
+const (
+	ociWhiteoutPrefix = ".wh."
+	ociWhiteoutOpaque = ".wh..wh..opq"
+)
+
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Platform  *struct {
+		Architecture string `json:"architecture"`
+		Variant      string `json:"variant"`
+	} `json:"platform"`
+}
+
+type ociIndex struct {
+	Manifests []ociDescriptor `json:"manifests"`
+}
+
+type ociManifest struct {
+	Config ociDescriptor   `json:"config"`
+	Layers []ociDescriptor `json:"layers"`
+}
+
+type ociConfig struct {
+	Architecture string `json:"architecture"`
+}
+
+type dockerManifest struct {
+	Config string   `json:"Config"`
+	Layers []string `json:"Layers"`
+}
+
+// OciSysrootProvisioner populates system root from a local OCI image layout
+// or a "docker save" tarball, fully offline.
+type OciSysrootProvisioner struct {
+	BaseSysrootProvisioner
+	image    string
+	imageDir string
+}
+
+func NewOciSysrootProvisioner(name, arch, root, image string) *OciSysrootProvisioner {
+	osp := new(OciSysrootProvisioner)
+	osp.kind = "oci"
+	osp.image = image
+
+	osp.SetArch(arch)
+	osp.SetName(name)
+	osp.SetSysPath(root)
+
+	osp.qemuPath, _ = sysmgr_lib.FindQemu(GetArchNames(osp.arch).Qemu, true)
+	osp.ref = osp
+
+	return osp
+}
+
+func (osp *OciSysrootProvisioner) Activate() error {
+	return osp.mountBinds()
+}
+
+func (osp *OciSysrootProvisioner) UnmountBinds() error {
+	return osp.umountBinds()
+}
+
+func (osp *OciSysrootProvisioner) getQemuPath() string {
+	return osp.qemuPath
+}
+
+func (osp *OciSysrootProvisioner) getSysPath() string {
+	return osp.sysPath
+}
+
+// GetArch returns an architecture name, as OCI platform knows it
+func (osp *OciSysrootProvisioner) GetArch() string {
+	return GetArchNames(osp.arch).Oci
+}
+
+func (osp *OciSysrootProvisioner) beforePopulate() error {
+	if osp.getQemuPath() == "" {
+		return fmt.Errorf("No static QEMU found for %s architecture", osp.arch)
+	}
+
+	info, err := os.Stat(osp.image)
+	if err != nil {
+		return fmt.Errorf("Unable to access image: %s", err.Error())
+	}
+
+	if info.IsDir() {
+		osp.imageDir = osp.image
+		return nil
+	}
+
+	// Saved image is unpacked as is, layers are applied later
+	osp.imageDir, err = ioutil.TempDir("", "sysroot-oci-")
+	if err != nil {
+		return err
+	}
+
+	return sysmgr_lib.LoggedExec("tar", "--extract", "--file", osp.image, "-C", osp.imageDir)
+}
+
+func (osp *OciSysrootProvisioner) onPopulate() error {
+	if osp.imageDir != osp.image {
+		defer os.RemoveAll(osp.imageDir)
+	}
+
+	layers, err := osp.getLayers()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(osp.sysrootPath, 0755); err != nil {
+		return err
+	}
+
+	for _, layer := range layers {
+		osp.GetLogger().Debugf("Applying layer %s", layer)
+		if err := osp.applyLayer(layer); err != nil {
+			return fmt.Errorf("Unable to apply layer %s: %s", path.Base(layer), err.Error())
+		}
+	}
+
+	return nil
+}
+
+func (osp *OciSysrootProvisioner) afterPopulate() error {
+	for _, d := range []string{"/etc", "/proc", "/dev", "/sys", "/run", "/tmp"} {
+		tp := path.Join(osp.sysrootPath, d)
+		if wzlib_utils.FileExists(tp) {
+			continue
+		}
+
+		if err := os.MkdirAll(tp, 0755); err != nil {
+			return err
+		}
+	}
+
+	return osp.writeConfig()
+}
+
+// readJSON file from the image
+func (osp *OciSysrootProvisioner) readJSON(fname string, obj interface{}) error {
+	data, err := ioutil.ReadFile(path.Join(osp.imageDir, fname))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, obj)
+}
+
+// getBlobPath returns a path of the blob by its digest
+func (osp *OciSysrootProvisioner) getBlobPath(digest string) (string, error) {
+	alg := strings.SplitN(digest, ":", 2)
+	if len(alg) != 2 || strings.Contains(alg[1], "/") {
+		return "", fmt.Errorf("Invalid digest: %s", digest)
+	}
+	return path.Join(osp.imageDir, "blobs", alg[0], alg[1]), nil
+}
+
+// getLayers returns paths to the layers of the image for the target architecture, from the bottom to the top
+func (osp *OciSysrootProvisioner) getLayers() ([]string, error) {
+	layers := []string{}
+
+	if wzlib_utils.FileExists(path.Join(osp.imageDir, "index.json")) {
+		manifest, err := osp.findManifest("index.json")
+		if err != nil {
+			return nil, err
+		}
+		for _, layer := range manifest.Layers {
+			blob, err := osp.getBlobPath(layer.Digest)
+			if err != nil {
+				return nil, err
+			}
+			layers = append(layers, blob)
+		}
+	} else if wzlib_utils.FileExists(path.Join(osp.imageDir, "manifest.json")) {
+		manifests := []dockerManifest{}
+		if err := osp.readJSON("manifest.json", &manifests); err != nil {
+			return nil, err
+		}
+		if len(manifests) != 1 {
+			return nil, fmt.Errorf("Saved image should contain exactly one image, but %d found", len(manifests))
+		}
+		if err := osp.checkConfigArch(manifests[0].Config); err != nil {
+			return nil, err
+		}
+		for _, layer := range manifests[0].Layers {
+			layers = append(layers, path.Join(osp.imageDir, path.Clean("/"+layer)))
+		}
+	} else {
+		return nil, fmt.Errorf("%s is neither OCI image layout nor saved Docker image", osp.image)
+	}
+
+	if len(layers) == 0 {
+		return nil, fmt.Errorf("No layers found in %s", osp.image)
+	}
+
+	return layers, nil
+}
+
+// findManifest walks the image index down to the manifest of the target architecture
+func (osp *OciSysrootProvisioner) findManifest(fname string) (*ociManifest, error) {
+	index := &ociIndex{}
+	if err := osp.readJSON(fname, index); err != nil {
+		return nil, err
+	}
+
+	for _, desc := range index.Manifests {
+		if desc.Platform != nil && desc.Platform.Architecture != osp.GetArch() {
+			continue
+		}
+
+		blob, err := osp.getBlobPath(desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		blob = blob[len(osp.imageDir):]
+
+		switch desc.MediaType {
+		case "application/vnd.oci.image.index.v1+json", "application/vnd.docker.distribution.manifest.list.v2+json":
+			if manifest, err := osp.findManifest(blob); err == nil {
+				return manifest, nil
+			}
+		default:
+			manifest := &ociManifest{}
+			if err := osp.readJSON(blob, manifest); err != nil {
+				return nil, err
+			}
+			config, err := osp.getBlobPath(manifest.Config.Digest)
+			if err != nil {
+				return nil, err
+			}
+			if err := osp.checkConfigArch(config[len(osp.imageDir):]); err != nil {
+				continue
+			}
+			return manifest, nil
+		}
+	}
+
+	return nil, fmt.Errorf("No image for %s architecture found in %s", osp.arch, osp.image)
+}
+
+// checkConfigArch verifies the image configuration belongs to the target architecture
+func (osp *OciSysrootProvisioner) checkConfigArch(fname string) error {
+	config := &ociConfig{}
+	if err := osp.readJSON(path.Clean("/"+fname), config); err != nil {
+		return err
+	}
+	if config.Architecture != "" && config.Architecture != osp.GetArch() {
+		return fmt.Errorf("Image is for %s architecture, but %s is required", config.Architecture, osp.GetArch())
+	}
+	return nil
+}
+
+// openLayer returns an uncompressed stream of the layer tarball
+func (osp *OciSysrootProvisioner) openLayer(fname string) (io.Reader, func(), error) {
+	fh, err := os.Open(fname)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	buf := bufio.NewReader(fh)
+	magic, _ := buf.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(buf)
+		if err != nil {
+			fh.Close()
+			return nil, nil, err
+		}
+		return gz, func() { gz.Close(); fh.Close() }, nil
+	case bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		cmd := exec.Command("zstd", "--decompress", "--stdout")
+		cmd.Stdin = buf
+		out, err := cmd.StdoutPipe()
+		if err != nil {
+			fh.Close()
+			return nil, nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			fh.Close()
+			return nil, nil, fmt.Errorf("Unable to decompress zstd layer: %s", err.Error())
+		}
+		return out, func() { cmd.Wait(); fh.Close() }, nil
+	}
+
+	return buf, func() { fh.Close() }, nil
+}
+
+// resolve a path inside the system root, following symlinks as if the system root was "/".
+// This keeps every layer entry within the system root.
+func (osp *OciSysrootProvisioner) resolve(pth string) (string, error) {
+	current := "/"
+	parts := strings.Split(pth, "/")
+	links := 0
+	for i := 0; i < len(parts); i++ {
+		if parts[i] == "" || parts[i] == "." {
+			continue
+		}
+
+		next := path.Join(current, parts[i])
+		info, err := os.Lstat(path.Join(osp.sysrootPath, next))
+		if err == nil && info.Mode()&os.ModeSymlink != 0 {
+			if links++; links > 255 {
+				return "", fmt.Errorf("Too many levels of symbolic links at %s", pth)
+			}
+			target, err := os.Readlink(path.Join(osp.sysrootPath, next))
+			if err != nil {
+				return "", err
+			}
+			if path.IsAbs(target) {
+				current = "/"
+			}
+			parts, i = append(strings.Split(target, "/"), parts[i+1:]...), -1
+			continue
+		}
+		current = next
+	}
+
+	return path.Join(osp.sysrootPath, current), nil
+}
+
+// applyLayer unpacks the layer over the system root
+func (osp *OciSysrootProvisioner) applyLayer(fname string) error {
+	stream, closer, err := osp.openLayer(fname)
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	created := map[string]bool{}
+	tr := tar.NewReader(stream)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		name := path.Clean("/" + hdr.Name)
+		if name == "/" {
+			continue
+		}
+
+		dir, base := path.Split(name)
+		parent, err := osp.resolve(dir)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(parent, 0755); err != nil {
+			return err
+		}
+
+		// Whiteouts only hide content of the lower layers
+		if base == ociWhiteoutOpaque {
+			entries, err := ioutil.ReadDir(parent)
+			if err != nil {
+				return err
+			}
+			for _, entry := range entries {
+				if !created[path.Join(parent, entry.Name())] {
+					if err := os.RemoveAll(path.Join(parent, entry.Name())); err != nil {
+						return err
+					}
+				}
+			}
+			continue
+		} else if strings.HasPrefix(base, ociWhiteoutPrefix) {
+			if err := os.RemoveAll(path.Join(parent, base[len(ociWhiteoutPrefix):])); err != nil {
+				return err
+			}
+			continue
+		}
+
+		target := path.Join(parent, base)
+		created[target] = true
+		if err := osp.applyEntry(hdr, tr, target); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyEntry writes one layer entry to the target path, with its ownership, mode and attributes
+func (osp *OciSysrootProvisioner) applyEntry(hdr *tar.Header, tr *tar.Reader, target string) error {
+	if info, err := os.Lstat(target); err == nil && !(info.IsDir() && hdr.Typeflag == tar.TypeDir) {
+		if err := os.RemoveAll(target); err != nil {
+			return err
+		}
+	}
+
+	mode := uint32(hdr.Mode) & 07777
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return err
+		}
+	case tar.TypeReg, tar.TypeRegA:
+		fh, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(fh, tr); err != nil {
+			fh.Close()
+			return err
+		}
+		if err := fh.Close(); err != nil {
+			return err
+		}
+	case tar.TypeSymlink:
+		if err := os.Symlink(hdr.Linkname, target); err != nil {
+			return err
+		}
+	case tar.TypeLink:
+		dir, base := path.Split(path.Clean("/" + hdr.Linkname))
+		parent, err := osp.resolve(dir)
+		if err != nil {
+			return err
+		}
+		if err := os.Link(path.Join(parent, base), target); err != nil {
+			return err
+		}
+		return nil
+	case tar.TypeChar:
+		if err := unix.Mknod(target, unix.S_IFCHR|mode, int(unix.Mkdev(uint32(hdr.Devmajor), uint32(hdr.Devminor)))); err != nil {
+			return err
+		}
+	case tar.TypeBlock:
+		if err := unix.Mknod(target, unix.S_IFBLK|mode, int(unix.Mkdev(uint32(hdr.Devmajor), uint32(hdr.Devminor)))); err != nil {
+			return err
+		}
+	case tar.TypeFifo:
+		if err := unix.Mkfifo(target, mode); err != nil {
+			return err
+		}
+	default:
+		osp.GetLogger().Warnf("Skipping unsupported entry %s", hdr.Name)
+		return nil
+	}
+
+	if err := os.Lchown(target, hdr.Uid, hdr.Gid); err != nil {
+		return err
+	}
+
+	for k, v := range hdr.PAXRecords {
+		if strings.HasPrefix(k, "SCHILY.xattr.") {
+			if err := unix.Lsetxattr(target, k[len("SCHILY.xattr."):], []byte(v), 0); err != nil {
+				osp.GetLogger().Warnf("Unable to set extended attribute %s on %s: %s", k, target, err.Error())
+			}
+		}
+	}
+
+	if hdr.Typeflag == tar.TypeSymlink {
+		return nil
+	}
+
+	// Mode is set after owner, as chown drops setuid/setgid bits
+	if err := unix.Chmod(target, mode); err != nil {
+		return err
+	}
+	return os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+}
@@ -3,78 +3,130 @@ package sysmgr_sr
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path"
-	"syscall"
 
-	"golang.org/x/sys/unix"
+	sysmgr_lib "github.com/infra-whizz/sys-mgr/lib"
+	wzlib_traits "github.com/infra-whizz/wzlib/traits"
+	wzlib_traits_attributes "github.com/infra-whizz/wzlib/traits/attributes"
+	wzlib_utils "github.com/infra-whizz/wzlib/utils"
 )
 
 type ZypperSysrootProvisioner struct {
 	BaseSysrootProvisioner
+	repoUrl   string
+	updateUrl string
+	zyppConf  string
 }
 
 func NewZypperSysrootProvisioner(name, arch, root string) *ZypperSysrootProvisioner {
 	zsp := new(ZypperSysrootProvisioner)
+	zsp.kind = "zypper"
 
 	zsp.SetArch(arch)
 	zsp.SetName(name)
 	zsp.SetSysPath(root)
+	zsp.zyppConf = path.Join(zsp.sysrootPath, "/etc/zypp/zypp.conf")
+
+	zsp.qemuPath, _ = sysmgr_lib.FindQemu(GetArchNames(zsp.arch).Qemu, true)
 	zsp.ref = zsp
 
+	zsp.sysinfo = wzlib_traits.NewWzTraitsContainer()
+	wzlib_traits_attributes.NewSysInfo().Load(zsp.sysinfo)
+
 	return zsp
 }
 
+// getRepoUrls returns main OSS and update repository URLs for the target architecture.
+// Everything except x86_64 is placed in the ports.
+func (zsp *ZypperSysrootProvisioner) getRepoUrls() (string, string, error) {
+	version, ok := zsp.sysinfo.Get("os.version").(string)
+	if !ok || version == "" {
+		return "", "", fmt.Errorf("Unable to determine release version of the host")
+	}
+
+	if zsp.arch == "x86_64" {
+		return fmt.Sprintf("http://download.opensuse.org/distribution/leap/%s/repo/oss/", version),
+			fmt.Sprintf("http://download.opensuse.org/update/leap/%s/oss/", version), nil
+	}
+	return fmt.Sprintf("http://download.opensuse.org/ports/%s/distribution/leap/%s/repo/oss/", zsp.GetArch(), version),
+		fmt.Sprintf("http://download.opensuse.org/ports/update/leap/%s/oss/", version), nil
+}
+
+// zypper calls zypper on the sysroot, locked to its own zypp.conf
+func (zsp *ZypperSysrootProvisioner) zypper(args ...string) error {
+	return sysmgr_lib.LoggedEnvExec(map[string]string{"ZYPP_CONF": zsp.zyppConf}, "zypper",
+		append([]string{"--non-interactive", "--gpg-auto-import-keys", "--root", zsp.sysrootPath}, args...)...)
+}
+
 func (zsp *ZypperSysrootProvisioner) beforePopulate() error {
-	return nil
+	if zsp.getQemuPath() == "" {
+		return fmt.Errorf("No static QEMU found for %s architecture", zsp.arch)
+	}
+
+	var err error
+	zsp.repoUrl, zsp.updateUrl, err = zsp.getRepoUrls()
+	if err != nil {
+		return err
+	}
+
+	// Package manager setup rewrites it later, but zypper needs the arch already to bootstrap
+	if err := os.MkdirAll(path.Dir(zsp.zyppConf), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(zsp.zyppConf, []byte(fmt.Sprintf("[main]\narch = %s\n", zsp.GetArch())), 0644)
 }
 
 func (zsp *ZypperSysrootProvisioner) onPopulate() error {
-	return nil
+	zsp.GetLogger().Debugf("Populating sysroot into %s", zsp.sysrootPath)
+
+	if err := zsp.zypper("addrepo", "--refresh", zsp.repoUrl, "repo-oss"); err != nil {
+		return err
+	}
+
+	if err := zsp.zypper("addrepo", "--refresh", zsp.updateUrl, "repo-update"); err != nil {
+		return err
+	}
+
+	if err := zsp.zypper("refresh"); err != nil {
+		return err
+	}
+
+	return zsp.zypper("install", "--no-recommends", "filesystem", "glibc", "rpm", "zypper")
 }
 
 func (zsp *ZypperSysrootProvisioner) afterPopulate() error {
-	return nil
+	for _, d := range []string{"/etc", "/proc", "/dev", "/sys", "/run", "/tmp"} {
+		tp := path.Join(zsp.sysrootPath, d)
+		if wzlib_utils.FileExists(tp) {
+			continue
+		}
+
+		if err := os.MkdirAll(tp, 0755); err != nil {
+			return err
+		}
+	}
+
+	return zsp.writeConfig()
 }
 
 func (dsp *ZypperSysrootProvisioner) getQemuPath() string {
-	return ""
+	return dsp.qemuPath
 }
 
 func (dsp *ZypperSysrootProvisioner) getSysPath() string {
 	return dsp.sysPath
 }
 
+// GetArch returns an architecture name, as zypper knows it
 func (dsp *ZypperSysrootProvisioner) GetArch() string {
-	return ""
+	return GetArchNames(dsp.arch).Rpm
 }
 
 func (dsp *ZypperSysrootProvisioner) Activate() error {
-	dsp.GetLogger().Info("Activating system root")
-	for _, src := range []string{"/proc", "/sys", "/dev", "/run"} {
-		dst := path.Join(dsp.sysrootPath, src)
-		dsp.GetLogger().Debugf("Mounting %s to %s", src, dst)
-		if err := syscall.Mount(src, dst, "", syscall.MS_BIND, ""); err != nil {
-			return err
-		}
-	}
-	return nil
+	return dsp.mountBinds()
 }
 
 func (dsp *ZypperSysrootProvisioner) UnmountBinds() error {
-	// pre-umount, if anything
-	for _, d := range []string{"/proc", "/dev", "/sys", "/run"} {
-		d = path.Join(dsp.sysrootPath, d)
-		if err := syscall.Unmount(d, syscall.MNT_DETACH|syscall.MNT_FORCE|unix.UMOUNT_NOFOLLOW); err != nil {
-			dsp.GetLogger().Warnf("Unable to unmount %s", d)
-		}
-		files, err := ioutil.ReadDir(d)
-		if err != nil {
-			return err
-		}
-		if len(files) > 0 {
-			return fmt.Errorf("Failed to unmount %s. Please umount it manually.", d)
-		}
-	}
-
-	return nil
+	return dsp.umountBinds()
 }
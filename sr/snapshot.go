@@ -0,0 +1,235 @@
+package sysmgr_sr
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	sysmgr_lib "github.com/infra-whizz/sys-mgr/lib"
+	"github.com/isbm/go-nanoconf"
+)
+
+// Directory within the system roots, where all the snapshots are kept
+var SnapshotsDir string = ".snapshots"
+
+// Snapshot metadata, placed next to the child system root config
+var SnapshotConfig string = "/etc/sysroot.snapshot"
+
+const (
+	SnapshotMethodBtrfs = "btrfs"
+	SnapshotMethodCopy  = "copy"
+)
+
+// SysrootSnapshot is a point-in-time copy of a system root
+type SysrootSnapshot struct {
+	Name    string
+	Arch    string
+	Tag     string
+	Method  string
+	Created time.Time
+	Path    string
+}
+
+// getSnapshotsPath returns a path to all snapshots of a particular system root
+func (srm *SysrootManager) getSnapshotsPath(name string, arch string) string {
+	return path.Join(srm.sysroots, SnapshotsDir, fmt.Sprintf("%s.%s", name, arch))
+}
+
+// snapshotTree makes a copy of the tree, using btrfs snapshot, if possible.
+// Copies are made into a new subvolume on btrfs, so they can be snapshotted next time.
+func (srm *SysrootManager) snapshotTree(src string, dst string) (string, error) {
+	if sysmgr_lib.IsBtrfsSubvolume(src) {
+		srm.GetLogger().Debugf("Taking btrfs snapshot of %s to %s", src, dst)
+		return SnapshotMethodBtrfs, sysmgr_lib.LoggedExec("btrfs", "subvolume", "snapshot", src, dst)
+	}
+
+	srm.GetLogger().Debugf("Copying %s to %s", src, dst)
+	if err := sysmgr_lib.MakeTreeRoot(dst); err != nil {
+		return "", err
+	}
+	return SnapshotMethodCopy, sysmgr_lib.CopyTree(src, dst)
+}
+
+// SnapshotSysRoot takes a snapshot of a system root. If tag is empty, current time is used instead.
+func (srm *SysrootManager) SnapshotSysRoot(name string, arch string, tag string) (*SysrootSnapshot, error) {
+	if err := srm.checkArch(arch); err != nil {
+		return nil, err
+	}
+
+	sysroot, err := NewSysRoot(srm.sysroots).SetName(name).SetArch(arch).Init()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &SysrootSnapshot{
+		Name:    sysroot.Name,
+		Arch:    sysroot.Arch,
+		Tag:     tag,
+		Created: time.Now(),
+	}
+	if snapshot.Tag == "" {
+		snapshot.Tag = snapshot.Created.Format("20060102-150405")
+	}
+	if strings.ContainsAny(snapshot.Tag, "/ ") {
+		return nil, fmt.Errorf("Invalid snapshot tag: %s", snapshot.Tag)
+	}
+
+	snapshotsPath := srm.getSnapshotsPath(sysroot.Name, sysroot.Arch)
+	snapshot.Path = path.Join(snapshotsPath, snapshot.Tag)
+	if _, err := os.Stat(snapshot.Path); !os.IsNotExist(err) {
+		return nil, fmt.Errorf("Snapshot '%s' of %s (%s) already exists", snapshot.Tag, sysroot.Name, sysroot.Arch)
+	}
+
+	if err := os.MkdirAll(snapshotsPath, 0700); err != nil {
+		return nil, err
+	}
+
+	// Runtime binds should not get into the snapshot
+	if err := sysroot.UmountBinds(); err != nil {
+		return nil, err
+	}
+
+	if snapshot.Method, err = srm.snapshotTree(sysroot.Path, snapshot.Path); err != nil {
+		return nil, err
+	}
+
+	if err := ioutil.WriteFile(path.Join(snapshot.Path, SnapshotConfig),
+		[]byte(fmt.Sprintf("name: %s\narch: %s\ntag: %s\nmethod: %s\ncreated: %s\n",
+			snapshot.Name, snapshot.Arch, snapshot.Tag, snapshot.Method, snapshot.Created.Format(time.RFC3339))), 0644); err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// GetSnapshots returns all snapshots of a system root, sorted by creation time.
+// If name is empty, snapshots of all system roots are returned.
+func (srm *SysrootManager) GetSnapshots(name string, arch string) ([]*SysrootSnapshot, error) {
+	snapshots := []*SysrootSnapshot{}
+
+	roots, err := ioutil.ReadDir(path.Join(srm.sysroots, SnapshotsDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return snapshots, nil
+		}
+		return nil, err
+	}
+
+	for _, root := range roots {
+		if strings.HasPrefix(root.Name(), ".") {
+			continue
+		}
+		if name != "" && root.Name() != fmt.Sprintf("%s.%s", name, arch) {
+			continue
+		}
+
+		tags, err := ioutil.ReadDir(path.Join(srm.sysroots, SnapshotsDir, root.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tag := range tags {
+			spath := path.Join(srm.sysroots, SnapshotsDir, root.Name(), tag.Name())
+			if _, err := os.Stat(path.Join(spath, SnapshotConfig)); os.IsNotExist(err) {
+				srm.GetLogger().Warnf("Skipping incomplete snapshot at %s", spath)
+				continue
+			}
+
+			conf := nanoconf.NewConfig(path.Join(spath, SnapshotConfig)).Root()
+			created, err := time.Parse(time.RFC3339, conf.String("created", ""))
+			if err != nil {
+				return nil, fmt.Errorf("Invalid snapshot at %s: %s", spath, err.Error())
+			}
+			// System root might be renamed since the snapshot was taken
+			na := strings.SplitN(root.Name(), ".", 2)
+			if len(na) != 2 {
+				return nil, fmt.Errorf("Unknown snapshots found at %s", path.Join(srm.sysroots, SnapshotsDir, root.Name()))
+			}
+			snapshots = append(snapshots, &SysrootSnapshot{
+				Name:    na[0],
+				Arch:    na[1],
+				Tag:     conf.String("tag", ""),
+				Method:  conf.String("method", ""),
+				Created: created,
+				Path:    spath,
+			})
+		}
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Created.Before(snapshots[j].Created)
+	})
+
+	return snapshots, nil
+}
+
+// RestoreSysRoot replaces the system root with its snapshot. If tag is empty, the latest snapshot is used.
+// Default flag of the system root is kept as is.
+func (srm *SysrootManager) RestoreSysRoot(name string, arch string, tag string) (*SysRoot, error) {
+	if err := srm.checkArch(arch); err != nil {
+		return nil, err
+	}
+
+	sysroot, err := NewSysRoot(srm.sysroots).SetName(name).SetArch(arch).Init()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots, err := srm.GetSnapshots(sysroot.Name, sysroot.Arch)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot *SysrootSnapshot
+	for _, s := range snapshots {
+		if tag == "" || s.Tag == tag {
+			snapshot = s
+		}
+	}
+	if snapshot == nil {
+		return nil, fmt.Errorf("No snapshot found for %s (%s)", sysroot.Name, sysroot.Arch)
+	}
+
+	if err := srm.CheckWithinSysroot(sysroot); err != nil {
+		return nil, err
+	}
+
+	if err := sysroot.UmountBinds(); err != nil {
+		return nil, err
+	}
+
+	// Current tree is moved away first, so it can be brought back, if restore fails
+	stale := path.Join(srm.sysroots, SnapshotsDir, fmt.Sprintf(".%s.%s.stale", sysroot.Name, sysroot.Arch))
+	if err := os.Rename(sysroot.Path, stale); err != nil {
+		return nil, err
+	}
+
+	srm.GetLogger().Infof("Restoring snapshot '%s' of %s (%s)", snapshot.Tag, sysroot.Name, sysroot.Arch)
+	if _, err := srm.snapshotTree(snapshot.Path, sysroot.Path); err != nil {
+		sysmgr_lib.RemoveTree(sysroot.Path)
+		if rerr := os.Rename(stale, sysroot.Path); rerr != nil {
+			return nil, fmt.Errorf("%s. Additionally, unable to bring back the original system root from %s: %s",
+				err.Error(), stale, rerr.Error())
+		}
+		return nil, err
+	}
+
+	if err := os.Remove(path.Join(sysroot.Path, SnapshotConfig)); err != nil {
+		return nil, err
+	}
+
+	restored, err := NewSysRoot(srm.sysroots).SetName(sysroot.Name).SetArch(sysroot.Arch).Init()
+	if err != nil {
+		return nil, err
+	}
+	if err := restored.SetDefault(sysroot.Default); err != nil {
+		return nil, err
+	}
+	restored.Default = sysroot.Default
+
+	return restored, sysmgr_lib.RemoveTree(stale)
+}
@@ -5,19 +5,29 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
-	"strconv"
+	"strings"
+	"time"
 
 	"github.com/elastic/go-sysinfo"
+	"github.com/go-yaml/yaml"
 	sysmgr_lib "github.com/infra-whizz/sys-mgr/lib"
 	wzlib_logger "github.com/infra-whizz/wzlib/logger"
 	"github.com/isbm/go-nanoconf"
+	"golang.org/x/sys/unix"
 )
 
 type SysRoot struct {
-	Name    string
-	Arch    string
-	Path    string
-	Default bool
+	Name        string
+	Arch        string
+	Path        string
+	Default     bool
+	Provisioner string
+	Created     time.Time
+
+	// Cached dynamic linker and library paths within the system root, valid for the glibc version
+	DynLinker   string
+	LibPath     []string
+	LibcVersion string
 
 	confPath string
 	sysPath  string
@@ -51,6 +61,12 @@ func (sr *SysRoot) SetArch(arch string) *SysRoot {
 	return sr
 }
 
+// SetProvisioner overrides the platform provisioner, e.g. to populate the system root from an image
+func (sr *SysRoot) SetProvisioner(provisioner SysrootProvisioner) *SysRoot {
+	sr._provisioner = provisioner
+	return sr
+}
+
 func (sr *SysRoot) GetProvisioner() (SysrootProvisioner, error) {
 	if sr._provisioner == nil {
 		// Initialise provisioner
@@ -60,6 +76,8 @@ func (sr *SysRoot) GetProvisioner() (SysrootProvisioner, error) {
 			sr._provisioner = NewDebianSysrootProvisioner(sr.Name, sr.Arch, sr.sysPath)
 		case "opensuse-leap":
 			sr._provisioner = NewZypperSysrootProvisioner(sr.Name, sr.Arch, sr.sysPath)
+		case "fedora", "rhel", "centos", "rocky", "almalinux":
+			sr._provisioner = NewDnfSysrootProvisioner(sr.Name, sr.Arch, sr.sysPath)
 		default:
 			return nil, fmt.Errorf("Unable to initialise provisioner for unsupported platform: %s", p)
 		}
@@ -108,6 +126,30 @@ func (sr *SysRoot) Init() (*SysRoot, error) {
 		sr.Default = isDefault.(bool)
 	}
 
+	sr.Provisioner = conf.Root().String("provisioner", "")
+
+	// Older system roots have no creation time, so the configuration is the oldest known
+	switch created := conf.Root().Raw()["created"].(type) {
+	case time.Time:
+		sr.Created = created
+	case string:
+		sr.Created, _ = time.Parse(time.RFC3339, created)
+	}
+	if sr.Created.IsZero() {
+		if info, err := os.Stat(sr.confPath); err == nil {
+			sr.Created = info.ModTime()
+		}
+	}
+
+	sr.DynLinker = conf.Root().String("dynlinker", "")
+	sr.LibcVersion = conf.Root().String("libc", "")
+	sr.LibPath = []string{}
+	if libpath, ok := conf.Root().Raw()["libpath"].([]interface{}); ok {
+		for _, p := range libpath {
+			sr.LibPath = append(sr.LibPath, fmt.Sprintf("%v", p))
+		}
+	}
+
 	if sr.Name == "" || sr.Arch == "" {
 		return nil, fmt.Errorf("Invalid configuration of a system root at %s", sr.Path)
 	}
@@ -142,6 +184,26 @@ func (sr *SysRoot) GetCurrentPlatform() string {
 	return info.Info().OS.Platform
 }
 
+// GetOSRelease returns parsed os-release of the system root
+func (sr *SysRoot) GetOSRelease() map[string]string {
+	release := map[string]string{}
+	for _, fn := range []string{"/etc/os-release", "/usr/lib/os-release"} {
+		data, err := ioutil.ReadFile(path.Join(sr.Path, fn))
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			kv := strings.SplitN(strings.TrimSpace(line), "=", 2)
+			if len(kv) != 2 || strings.HasPrefix(kv[0], "#") {
+				continue
+			}
+			release[kv[0]] = strings.Trim(kv[1], "\"'")
+		}
+		break
+	}
+	return release
+}
+
 // Create a system root
 func (sr *SysRoot) Create() error {
 	provisioner, err := sr.GetProvisioner()
@@ -175,7 +237,15 @@ func (sr *SysRoot) Delete() error {
 		return err
 	}
 
-	// check if the sysroot still bound to something
+	if err := sr.CheckUnbound(); err != nil {
+		return err
+	}
+
+	return sysmgr_lib.RemoveTree(sr.Path)
+}
+
+// CheckUnbound returns an error, if the sysroot is still bound to the runtime directories of the host
+func (sr *SysRoot) CheckUnbound() error {
 	for _, d := range []string{"/proc", "/dev", "/sys", "/run"} {
 		d = path.Join(sr.Path, d)
 		files, err := ioutil.ReadDir(d)
@@ -187,22 +257,48 @@ func (sr *SysRoot) Delete() error {
 		}
 	}
 
-	return os.RemoveAll(sr.Path)
+	return nil
 }
 
 // SEtDefault system root
 func (sr *SysRoot) SetDefault(isDefault bool) error {
+	return sr.UpdateConfig(map[string]interface{}{"default": isDefault})
+}
+
+// UpdateConfig of the system root with the given values, keeping everything else as is. Nil values are removed.
+func (sr *SysRoot) UpdateConfig(values map[string]interface{}) error {
 	if err := sr.checkExistingSysroot(false); err != nil {
 		return err
 	}
 
-	provisioner, err := sr.GetProvisioner()
+	confPath, err := sr.getConfigPath()
 	if err != nil {
 		return err
 	}
 
-	return ioutil.WriteFile(provisioner.GetConfigPath(), []byte(fmt.Sprintf("name: %s\narch: %s\ndefault: %s\n",
-		sr.Name, sr.Arch, strconv.FormatBool(isDefault))), 0644)
+	conf := nanoconf.NewConfig(confPath).Root().Raw()
+	if conf == nil {
+		conf = map[string]interface{}{}
+	}
+	if _, ex := conf["default"]; !ex {
+		conf["default"] = false
+	}
+	conf["name"] = sr.Name
+	conf["arch"] = sr.Arch
+	for k, v := range values {
+		if v == nil {
+			delete(conf, k)
+		} else {
+			conf[k] = v
+		}
+	}
+
+	data, err := yaml.Marshal(conf)
+	if err != nil {
+		return err
+	}
+
+	return sysmgr_lib.WriteFileAtomic(confPath, data, 0644)
 }
 
 // Activate default sysroot (mount runtime directories)
@@ -214,3 +310,42 @@ func (sr *SysRoot) Activate() error {
 
 	return provisioner.Activate()
 }
+
+// getConfigPath returns a path to the configuration of the system root
+func (sr *SysRoot) getConfigPath() (string, error) {
+	if sr.confPath != "" {
+		return sr.confPath, nil
+	}
+
+	provisioner, err := sr.GetProvisioner()
+	if err != nil {
+		return "", err
+	}
+	return provisioner.GetConfigPath(), nil
+}
+
+// IsConfigWritable returns true, if the configuration of the system root can be updated by the caller
+func (sr *SysRoot) IsConfigWritable() bool {
+	confPath, err := sr.getConfigPath()
+	if err != nil {
+		return false
+	}
+	return unix.Access(path.Dir(confPath), unix.W_OK) == nil
+}
+
+// SetLinkerCache stores the dynamic linker and library paths of the system root, found for the given glibc version
+func (sr *SysRoot) SetLinkerCache(linker string, libpath []string, libc string) error {
+	sr.DynLinker, sr.LibPath, sr.LibcVersion = linker, libpath, libc
+	return sr.UpdateConfig(map[string]interface{}{"dynlinker": linker, "libpath": libpath, "libc": libc})
+}
+
+// InvalidateLinkerCache removes the cached dynamic linker and library paths, e.g. after glibc was changed
+func (sr *SysRoot) InvalidateLinkerCache() error {
+	if sr.DynLinker == "" {
+		return nil
+	}
+
+	sr.GetLogger().Debugf("Invalidating cached dynamic linker %s", sr.DynLinker)
+	sr.DynLinker, sr.LibPath, sr.LibcVersion = "", []string{}, ""
+	return sr.UpdateConfig(map[string]interface{}{"dynlinker": nil, "libpath": nil, "libc": nil})
+}
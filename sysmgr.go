@@ -2,10 +2,11 @@ package sysmgr
 
 import (
 	"fmt"
-	"io/ioutil"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"sort"
 	"strings"
@@ -14,6 +15,7 @@ import (
 	sysmgr_lib "github.com/infra-whizz/sys-mgr/lib"
 	sysmgr_pm "github.com/infra-whizz/sys-mgr/pm"
 	sysmgr_sr "github.com/infra-whizz/sys-mgr/sr"
+	sysmgr_toolchain "github.com/infra-whizz/sys-mgr/toolchain"
 	wzlib_logger "github.com/infra-whizz/wzlib/logger"
 	wzlib_subprocess "github.com/infra-whizz/wzlib/subprocess"
 	"github.com/isbm/go-nanoconf"
@@ -34,6 +36,9 @@ type SysrootManager struct {
 
 var VERSION string = "2.0"
 
+// Exit code, if no system roots were found
+const ExitNoSysroots = 2
+
 // NewSysrootManager constructor
 func NewSysrootManager(appname string) *SysrootManager {
 	srm := new(SysrootManager)
@@ -45,14 +50,19 @@ func NewSysrootManager(appname string) *SysrootManager {
 	for _, arch := range srm.binfmt.Architectures {
 		if arch != nil {
 			srm.architectures = append(srm.architectures, arch.Name)
+			sysmgr_sr.SetArchNames(arch.Name, &sysmgr_sr.ArchNames{Dpkg: arch.DpkgArch, Rpm: arch.RpmArch, Oci: arch.OciArch, Qemu: arch.Qemu})
 		}
 	}
 
 	sort.Strings(srm.architectures)
 
 	confpath := nanoconf.NewNanoconfFinder("sysroots").DefaultSetup(nil)
-	srm.mgr = sysmgr_sr.NewSysrootManager(nanoconf.NewConfig(confpath.SetDefaultConfig(confpath.FindFirst()).FindDefault())).
-		SetSupportedArchitectures(srm.architectures)
+	conf := nanoconf.NewConfig(confpath.SetDefaultConfig(confpath.FindFirst()).FindDefault())
+	srm.mgr = sysmgr_sr.NewSysrootManager(conf).SetSupportedArchitectures(srm.architectures)
+
+	if err := srm.binfmt.SetFlags(conf.Root().String("binfmt-flags", "")); err != nil {
+		wzlib_logger.GetCurrentLogger().Warningf("Ignoring binfmt_misc flags: %s", err.Error())
+	}
 
 	return srm
 }
@@ -96,54 +106,30 @@ func (srm SysrootManager) RunArchGate() error {
 			os.Exit(0)
 		}
 
-		dr, err := srm.mgr.GetDefaultSysroot()
+		isChrooted, err := srm.mgr.IsChrooted()
 		if err != nil {
-			return fmt.Errorf("Error getting default system root: %s", err.Error())
-		}
-
-		if dr.Arch == "" {
-			return fmt.Errorf("Sysroot has no architecture defined")
+			return err
 		}
 
-		arch, err := srm.binfmt.GetArch(dr.Arch)
+		// Arguments belong to the called binary, so the system root is found by the binary itself
+		argv := os.Args[1:]
+		binArch, _ := srm.binfmt.GetArchByELF(argv[0])
+		dr, err := srm.getGateSysroot(argv[0], binArch, isChrooted)
 		if err != nil {
-			return fmt.Errorf("Error getting architecture for the system root: %s", err.Error())
+			return fmt.Errorf("Error getting system root: %s", err.Error())
 		}
 
-		var args []string
-
-		isChrooted, err := srm.mgr.IsChrooted()
-		if err != nil {
-			return err
+		// With "P" flag, kernel passes the original argv[0] after the binary path
+		entryArch, argv0 := dr.Arch, ""
+		if binArch != nil {
+			entryArch = binArch.Name
 		}
-
-		if isChrooted {
-			args = os.Args[1:]
-		} else {
-			if dr == nil {
-				return fmt.Errorf("Sysroot was not found")
-			}
-			// Call natively
-			linker, err := srm.FindDynLinker()
-			if err != nil {
-				return fmt.Errorf("Error getting dynamic linker: %s", err.Error())
-			}
-
-			// Lib path
-			libPath := []string{path.Join(dr.Path, "/usr/lib"), path.Join(dr.Path, "/lib")}
-			if arch.CPUBit == 0x40 {
-				libPath = append(libPath, path.Join(dr.Path, "/usr/lib64"), path.Join(dr.Path, "/lib64"))
-			}
-			args = append([]string{path.Join(dr.Path, linker), "--library-path", strings.Join(libPath, ":")}, os.Args[1:]...)
+		if entry, err := srm.binfmt.GetEntry(entryArch); err == nil && entry.HasFlag('P') && len(argv) > 1 {
+			argv0 = argv[1]
+			argv = append(argv[:1:1], argv[2:]...)
 		}
 
-		// XXX: Caller is distro-specific. E.g. on Ubuntu it is "qemu-<arch>-static".
-		//      This needs to have a better setup per a distro.
-		cmd := wzlib_subprocess.ExecCommand(fmt.Sprintf("/usr/bin/qemu-%s", arch.Name), args...)
-		cmd.Stderr = os.Stderr
-		cmd.Stdout = os.Stdout
-		cmd.Stdin = os.Stdin
-		if err := cmd.Run(); err != nil {
+		if err := srm.runInSysroot(dr, argv, argv0, isChrooted); err != nil {
 			fmt.Println("Gate runtime call error:", err.Error())
 			os.Exit(1)
 		}
@@ -151,6 +137,14 @@ func (srm SysrootManager) RunArchGate() error {
 		os.Exit(0)
 	}
 
+	// pkg-config of a target, e.g. "aarch64-linux-gnu-pkg-config"
+	if strings.HasSuffix(srm.appname, PkgConfigSuffix) {
+		if err := srm.RunPkgConfig(); err != nil {
+			return err
+		}
+		os.Exit(0)
+	}
+
 	if srm.appname != fmt.Sprintf("%s-sysroot", srm.pkgman.Name()) {
 		wzlib_logger.GetCurrentLogger().Errorf("Call: %s, args %s", srm.appname, os.Args)
 		wzlib_logger.GetCurrentLogger().Errorf("This app should be called '%s-sysroot'.", srm.pkgman.Name())
@@ -161,13 +155,282 @@ func (srm SysrootManager) RunArchGate() error {
 	return nil
 }
 
+// getGateSysroot returns a system root, where the binary belongs to. It is looked up by the path of the binary,
+// then by its architecture among all system roots, preferring the selected one, and then the selected one is returned.
+func (srm SysrootManager) getGateSysroot(bin string, arch *sysmgr_arch.Arch, isChrooted bool) (*sysmgr_sr.SysRoot, error) {
+	if isChrooted {
+		return srm.mgr.GetDefaultSysroot()
+	}
+
+	if abs, err := filepath.Abs(bin); err == nil {
+		if rel, err := filepath.Rel(srm.mgr.GetSysrootsPath(), abs); err == nil && !strings.HasPrefix(rel, "..") {
+			if dr, err := srm.mgr.GetSysroot(strings.Split(rel, "/")[0]); err == nil {
+				return dr, nil
+			}
+		}
+	}
+
+	selected, err := srm.mgr.GetSelectedSysroot("")
+	if arch == nil || (err == nil && selected.Arch == arch.Name) {
+		return selected, err
+	}
+
+	sysroots, serr := srm.mgr.GetSysRoots()
+	if serr != nil {
+		return nil, serr
+	}
+	for _, dr := range sysroots {
+		if dr.Arch == arch.Name {
+			return dr, nil
+		}
+	}
+
+	return selected, err
+}
+
+// runInSysroot calls a binary of the system root architecture via QEMU user emulator.
+// Outside of the system root, the binary is started by the dynamic linker of the system root with its libraries.
+// Original argv[0], if given, is passed to the first program, started by QEMU.
+func (srm SysrootManager) runInSysroot(dr *sysmgr_sr.SysRoot, argv []string, argv0 string, isChrooted bool) error {
+	if dr.Arch == "" {
+		return fmt.Errorf("Sysroot has no architecture defined")
+	}
+
+	arch, err := srm.binfmt.GetArch(dr.Arch)
+	if err != nil {
+		return fmt.Errorf("Error getting architecture for the system root: %s", err.Error())
+	}
+
+	// Emulator is chosen by the binary, as it is not necessarily of the system root architecture (e.g. n32 on mips64)
+	if binArch, err := srm.binfmt.GetArchByELF(argv[0]); err == nil {
+		arch = binArch
+	}
+
+	args := argv
+	if !isChrooted {
+		// Call natively
+		loader, err := srm.getLoaderArgs(dr, arch, argv[0])
+		if err != nil {
+			return err
+		}
+		args = append(loader, argv...)
+	}
+
+	// Inside the system root only a static emulator is working
+	qemu, err := sysmgr_lib.FindQemu(arch.Qemu, isChrooted)
+	if err != nil {
+		return err
+	}
+	// Started by the dynamic linker, the binary still gets its path as argv[0]
+	if argv0 != "" {
+		args = append([]string{"-0", argv0}, args...)
+	}
+	cmd := wzlib_subprocess.ExecCommand(qemu, args...)
+	cmd.Stderr = os.Stderr
+	cmd.Stdout = os.Stdout
+	cmd.Stdin = os.Stdin
+
+	return cmd.Run()
+}
+
+// Dynamic string tokens of the search paths
+var (
+	originToken   = regexp.MustCompile(`\$\{ORIGIN\}|\$ORIGIN\b`)
+	platformToken = regexp.MustCompile(`\$\{(LIB|PLATFORM)\}|\$(LIB|PLATFORM)\b`)
+)
+
+// mapSearchPath of a binary into the system root. $ORIGIN is the directory of the binary on the host,
+// so entries with it are not mapped. Entries with $LIB or $PLATFORM depend on the linker build and are skipped,
+// same as relative ones, which depend on the current directory.
+func mapSearchPath(root string, origin string, paths []string) (mapped []string, skipped []string) {
+	mapped, skipped = []string{}, []string{}
+	for _, p := range paths {
+		if platformToken.MatchString(p) {
+			skipped = append(skipped, p)
+		} else if originToken.MatchString(p) {
+			mapped = append(mapped, path.Clean(originToken.ReplaceAllLiteralString(p, origin)))
+		} else if strings.HasPrefix(p, "/") {
+			mapped = append(mapped, path.Join(root, p))
+		} else {
+			skipped = append(skipped, p)
+		}
+	}
+	return mapped, skipped
+}
+
+// getLoaderArgs returns a call of the dynamic linker of the system root for the binary, or nothing for static binaries.
+// Dynamic linker (PT_INTERP) and library search paths (DT_RPATH, DT_RUNPATH), requested by the binary,
+// are mapped into the system root. If the requested linker is not there, the one of the system root is used.
+func (srm SysrootManager) getLoaderArgs(dr *sysmgr_sr.SysRoot, arch *sysmgr_arch.Arch, bin string) ([]string, error) {
+	info, err := sysmgr_arch.ReadElfInfo(bin)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read ELF binary %s: %s", bin, err.Error())
+	}
+	if info.Interp == "" {
+		return []string{}, nil
+	}
+
+	linker := info.Interp
+	if _, err := os.Stat(path.Join(dr.Path, linker)); err != nil {
+		if linker, err = srm.FindDynLinker(dr); err != nil {
+			return nil, fmt.Errorf("Error getting dynamic linker: %s", err.Error())
+		}
+	}
+
+	libpath := arch.LibPath(dr.Path)
+	if len(dr.LibPath) > 0 && arch.Name == dr.Arch {
+		libpath = []string{}
+		for _, d := range dr.LibPath {
+			libpath = append(libpath, path.Join(dr.Path, d))
+		}
+	}
+
+	origin := path.Dir(bin)
+	if abs, err := filepath.Abs(bin); err == nil {
+		origin = path.Dir(abs)
+	}
+	rpath, skipped := mapSearchPath(dr.Path, origin, info.RPath)
+	runpath, rskipped := mapSearchPath(dr.Path, origin, info.RunPath)
+	for _, p := range append(skipped, rskipped...) {
+		wzlib_logger.GetCurrentLogger().Debugf("Skipping library search path %s of %s", p, bin)
+	}
+
+	// DT_RPATH is searched before the library path and DT_RUNPATH after it
+	search := append(append(rpath, libpath...), runpath...)
+	args := []string{path.Join(dr.Path, linker), "--library-path", strings.Join(search, ":")}
+
+	// Original search paths are pointing to the host. Only glibc linker can ignore them.
+	if len(info.RPath)+len(info.RunPath) > 0 && !strings.HasPrefix(path.Base(linker), "ld-musl") {
+		args = append(args, "--inhibit-rpath", bin)
+	}
+
+	return args, nil
+}
+
+// findBinary to run in the system root. Absolute paths are taken from the system root first and then from the host,
+// relative paths are taken from the host and bare names are looked up in the system root.
+func (srm SysrootManager) findBinary(dr *sysmgr_sr.SysRoot, name string) (string, error) {
+	candidates := []string{}
+	if strings.HasPrefix(name, "/") {
+		candidates = append(candidates, path.Join(dr.Path, name), name)
+	} else if strings.Contains(name, "/") {
+		abs, err := filepath.Abs(name)
+		if err != nil {
+			return "", err
+		}
+		candidates = append(candidates, abs)
+	} else {
+		for _, d := range []string{"/usr/local/bin", "/usr/bin", "/bin", "/usr/sbin", "/sbin"} {
+			candidates = append(candidates, path.Join(dr.Path, d, name))
+		}
+	}
+
+	for _, bin := range candidates {
+		if info, err := os.Stat(bin); err == nil && !info.IsDir() {
+			return bin, nil
+		}
+	}
+	return "", fmt.Errorf("Binary %s was not found", name)
+}
+
+// runBinary of the system root architecture directly, without binfmt_misc registration and root privileges.
+// Exit code of the binary is passed through.
+func (srm SysrootManager) runBinary(id string, args []string) error {
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("No command to run has been specified")
+	}
+
+	dr, err := srm.mgr.GetSelectedSysroot(id)
+	if err != nil {
+		return err
+	}
+
+	isChrooted, err := srm.mgr.IsChrooted()
+	if err != nil {
+		return err
+	}
+
+	bin, err := srm.findBinary(dr, args[0])
+	if err != nil {
+		return err
+	}
+
+	if err := srm.runInSysroot(dr, append([]string{bin}, args[1:]...), "", isChrooted); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			os.Exit(exitErr.ExitCode())
+		}
+		return err
+	}
+
+	return nil
+}
+
 // Run underlying package manager
 func (srm SysrootManager) RunPackageManager() error {
-	sysroot, err := srm.mgr.GetDefaultSysroot()
+	id, wait, args := srm.popGlobalArgs(os.Args[1:])
+
+	if len(args) > 0 && args[0] == "run" {
+		global, err := srm.mgr.SetLockWait(wait).LockGlobal(false)
+		if err != nil {
+			return err
+		}
+		defer global.Unlock()
+
+		return srm.runBinary(id, args[1:])
+	}
+
+	sysroot, err := srm.mgr.GetSelectedSysroot(id)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("No command to the package manager has been specified")
+	}
+
+	global, err := srm.mgr.SetLockWait(wait).LockGlobal(false)
 	if err != nil {
 		return err
 	}
-	return srm.pkgman.SetSysroot(sysroot).Call(os.Args[1:]...)
+	defer global.Unlock()
+
+	// Queries can run in parallel, transactions can not
+	lock, err := srm.mgr.LockSysroot(sysroot.Name, sysroot.Arch, srm.pkgman.IsMutating(args...))
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	return srm.pkgman.SetSysroot(sysroot).SetFixlets(srm.mgr.GetFixlets(sysroot)).Call(args...)
+}
+
+// popGlobalArgs takes out "--sysroot name.arch" (or "--sysroot=name.arch"), "--wait" and "--no-wait"
+// from the options before the command, so the rest can be passed to the underlying package manager
+// or to the binary as is.
+func (srm SysrootManager) popGlobalArgs(args []string) (string, bool, []string) {
+	id, wait := "", true
+	out := []string{}
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--" || !strings.HasPrefix(args[i], "-"):
+			return id, wait, append(out, args[i:]...)
+		case args[i] == "--sysroot":
+			// Missing value selects nothing
+			if i+1 < len(args) {
+				id = args[i+1]
+				i++
+			}
+		case strings.HasPrefix(args[i], "--sysroot="):
+			id = strings.TrimPrefix(args[i], "--sysroot=")
+		case args[i] == "--wait" || args[i] == "--no-wait":
+			wait = args[i] == "--wait"
+		default:
+			out = append(out, args[i])
+		}
+	}
+	return id, wait, out
 }
 
 // Get the name of the architecture
@@ -243,7 +506,13 @@ func (srm SysrootManager) actionCreate(ctx *cli.Context) error {
 	isDefault := len(roots) == 0 // True only if no system roots has been created at all
 	name, arch := srm.getNameArch(ctx)
 	srm.GetLogger().Infof("Creating system root: %s (%s)", name, arch)
-	sysroot, err := srm.mgr.CreateSysRoot(name, arch)
+
+	var sysroot *sysmgr_sr.SysRoot
+	if image := ctx.String("from-oci"); image != "" {
+		sysroot, err = srm.mgr.CreateSysRootFromOCI(name, arch, image)
+	} else {
+		sysroot, err = srm.mgr.CreateSysRoot(name, arch)
+	}
 	if err != nil {
 		return err
 	}
@@ -273,12 +542,17 @@ func (srm SysrootManager) actionCreate(ctx *cli.Context) error {
 }
 
 // actionListSysroots lists to the stdout all the system roots available
-func (srm SysrootManager) actionListSysroots() error {
+func (srm SysrootManager) actionListSysroots(ctx *cli.Context) error {
 	roots, err := srm.mgr.GetSysRoots()
 	if err != nil {
 		return err
 	}
-	if len(roots) > 0 {
+
+	if format := ctx.String("format"); format != "" {
+		if err := srm.printSysroots(format, roots, false); err != nil {
+			return err
+		}
+	} else if len(roots) > 0 {
 		fmt.Printf("Found %d system roots:\n", len(roots))
 		for idx, sr := range roots {
 			d := " "
@@ -288,18 +562,25 @@ func (srm SysrootManager) actionListSysroots() error {
 			fmt.Printf("%s  %d. %s (%s)\n", d, idx+1, sr.Name, sr.Arch)
 
 		}
-	} else {
-		srm.GetLogger().Errorln("No system roots configured yet")
+	}
+
+	if len(roots) == 0 {
+		return cli.Exit("No system roots configured yet", ExitNoSysroots)
 	}
 	return nil
 }
 
 // actionShowDefaultPath shows the path to the default system root
-func (srm SysrootManager) actionShowDefaultPath() error {
+func (srm SysrootManager) actionShowDefaultPath(ctx *cli.Context) error {
 	sr, err := srm.mgr.GetDefaultSysroot()
 	if err != nil {
-		return err
+		return cli.Exit(err.Error(), ExitNoSysroots)
+	}
+
+	if format := ctx.String("format"); format != "" {
+		return srm.printSysroots(format, []*sysmgr_sr.SysRoot{sr}, true)
 	}
+
 	fmt.Println(sr.Path)
 	return nil
 }
@@ -357,10 +638,251 @@ func (srm SysrootManager) actionDeleteSysroot(ctx *cli.Context) error {
 	return nil
 }
 
+// actionCloneSysroot copies a specified system root under a new name
+func (srm SysrootManager) actionCloneSysroot(ctx *cli.Context) error {
+	srm.ExitOnNonRootUID()
+	name, arch := srm.getNameArch(ctx)
+	clone, err := srm.mgr.CloneSysRoot(name, arch, ctx.String("to"))
+	if err != nil {
+		return err
+	}
+	srm.GetLogger().Infof("System root %s (%s) has been cloned to %s", name, arch, clone.Name)
+
+	return nil
+}
+
+// actionRenameSysroot renames a specified system root, keeping it default, if it was
+func (srm SysrootManager) actionRenameSysroot(ctx *cli.Context) error {
+	srm.ExitOnNonRootUID()
+	name, arch := srm.getNameArch(ctx)
+	sysroot, err := srm.mgr.RenameSysRoot(name, arch, ctx.String("to"))
+	if err != nil {
+		return err
+	}
+	srm.GetLogger().Infof("System root %s (%s) has been renamed to %s", name, arch, sysroot.Name)
+
+	if !sysroot.Default {
+		return nil
+	}
+
+	// Re-create systemd unit and binfmt registration for the new name
+	if err := ctx.Set("name", sysroot.Name); err != nil {
+		return err
+	}
+	return srm.actionSetDefault(ctx)
+}
+
+// actionSnapshotSysroot takes a snapshot of a specified system root
+func (srm SysrootManager) actionSnapshotSysroot(ctx *cli.Context) error {
+	srm.ExitOnNonRootUID()
+	name, arch := srm.getNameArch(ctx)
+	snapshot, err := srm.mgr.SnapshotSysRoot(name, arch, ctx.String("tag"))
+	if err != nil {
+		return err
+	}
+	srm.GetLogger().Infof("Snapshot '%s' of %s (%s) has been taken (%s)", snapshot.Tag, snapshot.Name, snapshot.Arch, snapshot.Method)
+
+	return srm.reactivate(name, arch)
+}
+
+// actionListSnapshots lists to the stdout all snapshots, optionally of a specified system root
+func (srm SysrootManager) actionListSnapshots(ctx *cli.Context) error {
+	name := ctx.String("name")
+	arch := ""
+	if name != "" {
+		name, arch = srm.getNameArch(ctx)
+	}
+
+	snapshots, err := srm.mgr.GetSnapshots(name, arch)
+	if err != nil {
+		return err
+	}
+	if len(snapshots) > 0 {
+		fmt.Printf("Found %d snapshots:\n", len(snapshots))
+		for idx, s := range snapshots {
+			fmt.Printf("   %d. %s (%s) %s, %s\n", idx+1, s.Name, s.Arch, s.Tag, s.Created.Format("2006-01-02 15:04:05"))
+		}
+	} else {
+		srm.GetLogger().Errorln("No snapshots have been taken yet")
+	}
+	return nil
+}
+
+// actionRestoreSysroot restores a system root from its snapshot
+func (srm SysrootManager) actionRestoreSysroot(ctx *cli.Context) error {
+	srm.ExitOnNonRootUID()
+	name, arch := srm.getNameArch(ctx)
+	if _, err := srm.mgr.RestoreSysRoot(name, arch, ctx.String("tag")); err != nil {
+		return err
+	}
+
+	return srm.reactivate(name, arch)
+}
+
+// actionExportSysroot packs a specified system root into an archive
+func (srm SysrootManager) actionExportSysroot(ctx *cli.Context) error {
+	srm.ExitOnNonRootUID()
+	name, arch := srm.getNameArch(ctx)
+	sysroot, err := sysmgr_sr.NewSysRoot(srm.mgr.GetSysrootsPath()).SetName(name).SetArch(arch).Init()
+	if err != nil {
+		return err
+	}
+
+	packages, err := srm.pkgman.SetSysroot(sysroot).GetInstalledPackages()
+	if err != nil {
+		return err
+	}
+
+	if err := srm.mgr.ExportSysRoot(name, arch, ctx.String("export"), packages); err != nil {
+		return err
+	}
+
+	return srm.reactivate(name, arch)
+}
+
+// actionImportSysroot unpacks a system root from an archive
+func (srm SysrootManager) actionImportSysroot(ctx *cli.Context) error {
+	srm.ExitOnNonRootUID()
+	manifest, err := srm.mgr.GetArchiveManifest(ctx.String("import"))
+	if err != nil {
+		return err
+	}
+
+	if _, err := srm.binfmt.GetArch(manifest.Arch); err != nil {
+		return err
+	}
+
+	roots, err := srm.mgr.GetSysRoots()
+	if err != nil {
+		return err
+	}
+
+	sysroot, err := srm.mgr.ImportSysRoot(ctx.String("import"), ctx.String("name"))
+	if err != nil {
+		return err
+	}
+	srm.GetLogger().Infof("System root %s (%s) has been imported with %d packages", sysroot.Name, sysroot.Arch, len(manifest.Packages))
+
+	// The very first system root becomes default
+	if len(roots) == 0 {
+		if err := ctx.Set("name", sysroot.Name); err != nil {
+			return err
+		}
+		if err := ctx.Set("arch", sysroot.Arch); err != nil {
+			return err
+		}
+		return srm.actionSetDefault(ctx)
+	}
+
+	return nil
+}
+
+// actionToolchain prints to the stdout a cross-compilation setup for a build system.
+// Unless a system root is specified, the selected one is used.
+func (srm SysrootManager) actionToolchain(ctx *cli.Context) error {
+	var sysroot *sysmgr_sr.SysRoot
+	var err error
+	if ctx.String("name") != "" {
+		name, arch := srm.getNameArch(ctx)
+		sysroot, err = srm.mgr.GetSysroot(fmt.Sprintf("%s.%s", name, arch))
+	} else {
+		sysroot, err = srm.mgr.GetSelectedSysroot("")
+	}
+	if err != nil {
+		return err
+	}
+
+	arch, err := srm.binfmt.GetArch(sysroot.Arch)
+	if err != nil {
+		return err
+	}
+
+	out, err := sysmgr_toolchain.NewToolchain(sysroot, arch).Generate(ctx.String("toolchain"))
+	if err != nil {
+		return err
+	}
+	fmt.Print(out)
+
+	return nil
+}
+
+// reactivate system root after its tree was touched, if it is a default one
+func (srm SysrootManager) reactivate(name string, arch string) error {
+	sr, err := srm.mgr.GetDefaultSysroot()
+	if err != nil || sr.Name != name || sr.Arch != arch {
+		return nil
+	}
+
+	return sr.Activate()
+}
+
+// lockSystemManager takes locks, required by the requested action, and returns a function to release them.
+// Locks are taken only once per action, as nested locks of the same file within one process would deadlock.
+func (srm SysrootManager) lockSystemManager(ctx *cli.Context) (func(), error) {
+	srm.mgr.SetLockWait(!ctx.Bool("no-wait"))
+
+	locks := []*sysmgr_sr.SysrootLock{}
+	unlock := func() {
+		for i := len(locks) - 1; i >= 0; i-- {
+			if err := locks[i].Unlock(); err != nil {
+				srm.GetLogger().Warnf("Unable to release lock: %s", err.Error())
+			}
+		}
+	}
+
+	// Operations, touching configuration of more than one system root, or a set of them.
+	// Creating the first system root also makes it default.
+	global, err := srm.mgr.LockGlobal(ctx.Bool("set") || ctx.Bool("delete") || ctx.Bool("rename") || ctx.Bool("create") ||
+		ctx.String("import") != "")
+	if err != nil {
+		return nil, err
+	}
+	locks = append(locks, global)
+
+	name, arch := ctx.String("name"), ctx.String("arch")
+	if name == "" || arch == "" {
+		return unlock, nil
+	}
+
+	targets := map[string]bool{}
+	if ctx.Bool("create") || ctx.Bool("snapshot") || ctx.Bool("restore") || ctx.String("export") != "" {
+		targets[name] = true
+	} else if ctx.Bool("clone") {
+		targets[name] = false
+		if ctx.String("to") != "" {
+			targets[ctx.String("to")] = true
+		}
+	}
+
+	// Always the same order, so crossing clones do not deadlock
+	names := []string{}
+	for target := range targets {
+		names = append(names, target)
+	}
+	sort.Strings(names)
+
+	for _, target := range names {
+		l, err := srm.mgr.LockSysroot(target, arch, targets[target])
+		if err != nil {
+			unlock()
+			return nil, err
+		}
+		locks = append(locks, l)
+	}
+
+	return unlock, nil
+}
+
 // Run system manager
 func (srm SysrootManager) RunSystemManager(ctx *cli.Context) error {
+	unlock, err := srm.lockSystemManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	if ctx.Bool("list") {
-		return srm.actionListSysroots()
+		return srm.actionListSysroots(ctx)
 	} else if ctx.Bool("create") {
 		return srm.actionCreate(ctx)
 	} else if ctx.Bool("delete") {
@@ -368,9 +890,34 @@ func (srm SysrootManager) RunSystemManager(ctx *cli.Context) error {
 	} else if ctx.Bool("set") {
 		return srm.actionSetDefault(ctx)
 	} else if ctx.Bool("path") {
-		return srm.actionShowDefaultPath()
+		return srm.actionShowDefaultPath(ctx)
 	} else if ctx.Bool("init") {
 		return srm.actionInitSysroot()
+	} else if ctx.Bool("clone") {
+		return srm.actionCloneSysroot(ctx)
+	} else if ctx.Bool("rename") {
+		return srm.actionRenameSysroot(ctx)
+	} else if ctx.Bool("snapshot") {
+		return srm.actionSnapshotSysroot(ctx)
+	} else if ctx.Bool("snapshots") {
+		return srm.actionListSnapshots(ctx)
+	} else if ctx.Bool("restore") {
+		return srm.actionRestoreSysroot(ctx)
+	} else if ctx.String("export") != "" {
+		return srm.actionExportSysroot(ctx)
+	} else if ctx.String("import") != "" {
+		return srm.actionImportSysroot(ctx)
+	} else if ctx.String("toolchain") != "" {
+		return srm.actionToolchain(ctx)
+	} else if ctx.Bool("run") {
+		id := ""
+		if ctx.String("name") != "" {
+			name, arch := srm.getNameArch(ctx)
+			id = fmt.Sprintf("%s.%s", name, arch)
+		}
+		return srm.runBinary(id, ctx.Args().Slice())
+	} else if ctx.Bool("binfmt-status") {
+		return srm.actionBinfmtStatus(ctx)
 	} else if ctx.Bool("version") {
 		fmt.Printf("sysroot-manager %s (%s)\n", VERSION, runtime.GOARCH)
 	} else {
@@ -379,33 +926,119 @@ func (srm SysrootManager) RunSystemManager(ctx *cli.Context) error {
 	return nil
 }
 
+func (srm SysrootManager) actionBinfmtStatus(ctx *cli.Context) error {
+	enabled, err := srm.binfmt.IsEnabled()
+	if err != nil {
+		return err
+	}
+	entries, err := srm.binfmt.GetEntries()
+	if err != nil {
+		return err
+	}
+
+	if format := ctx.String("format"); format != "" {
+		return srm.printBinfmtEntries(format, enabled, entries)
+	}
+
+	state := "enabled"
+	if !enabled {
+		state = "disabled"
+	}
+	fmt.Printf("binfmt_misc is %s, %d handlers registered:\n", state, len(entries))
+	for _, e := range entries {
+		state, m := "enabled", " "
+		if !e.Enabled {
+			state = "disabled"
+		}
+		if e.IsOwn() {
+			m = "*"
+		}
+		flags := e.Flags
+		if flags == "" {
+			flags = "-"
+		}
+		fmt.Printf("%s  %s (%s): %s, flags: %s, offset: %d\n", m, e.Name, state, e.Interpreter, flags, e.Offset)
+		if e.InterpreterMissing {
+			srm.GetLogger().Warningf("Interpreter of %s does not exist: %s", e.Name, e.Interpreter)
+		}
+		if len(e.Conflicts) > 0 {
+			srm.GetLogger().Warningf("%s conflicts with %s", e.Name, strings.Join(e.Conflicts, ", "))
+		}
+	}
+
+	return nil
+}
+
+// cacheDynLinker stores the dynamic linker in the system root config, unless it is busy.
+// Unprivileged callers are still running, just without the cache.
+func (srm *SysrootManager) cacheDynLinker(sr *sysmgr_sr.SysRoot, ldpath string, libpath []string) error {
+	if !sr.IsConfigWritable() {
+		return nil
+	}
+
+	// Config is also rewritten by managing the system roots, which should not be waited for
+	global, err := srm.mgr.TryLockGlobal(false)
+	if err != nil {
+		return err
+	}
+	defer global.Unlock()
+
+	lock, err := srm.mgr.TryLockSysroot(sr.Name, sr.Arch, true)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	return sr.SetLinkerCache(ldpath, libpath, srm.pkgman.SetSysroot(sr).GetLibcVersion())
+}
+
 // FindDynLinker returns a path to a dynamic linker of the sysroot.
 // This is needed only when running binaries of the sysroot,
 // so at the time of sysroot creation, the glibc is not there yet.
 //
-// First time it will scan standard places, like /lib or /lib64
-func (srm *SysrootManager) FindDynLinker() (string, error) {
-	sr, err := srm.mgr.GetDefaultSysroot()
+// First time it will scan standard places, like /lib or /lib64, for the linker names of the architecture,
+// and cache the result in the sysroot config along with the existing library paths.
+func (srm *SysrootManager) FindDynLinker(sr *sysmgr_sr.SysRoot) (string, error) {
+	if sr.DynLinker != "" {
+		if _, err := os.Stat(path.Join(sr.Path, sr.DynLinker)); err == nil {
+			return sr.DynLinker, nil
+		}
+	}
+
+	arch, err := srm.binfmt.GetArch(sr.Arch)
 	if err != nil {
 		return "", err
 	}
 
-	for _, ldl := range []string{"lib64", "lib"} {
-		libpath := path.Join(sr.Path, ldl)
-		content, err := ioutil.ReadDir(libpath)
-		if err != nil {
-			continue
-		}
-		for _, f := range content {
-			if !f.IsDir() && strings.HasPrefix(f.Name(), "ld-linux") {
-				ldpath, err := filepath.EvalSymlinks(path.Join(libpath, f.Name()))
-				if err != nil {
-					return "", err
+	dirs := []string{"lib64", "lib", "lib32"}
+	if arch.Multiarch != "" {
+		dirs = append(dirs, path.Join("lib", arch.Multiarch))
+	}
+
+	for _, ldl := range dirs {
+		for _, name := range arch.DynLinkers {
+			ldpath := path.Join(sr.Path, ldl, name)
+			if _, err := os.Stat(ldpath); err != nil {
+				continue
+			}
+
+			// Absolute symlinks would point to the host
+			if resolved, err := filepath.EvalSymlinks(ldpath); err == nil && strings.HasPrefix(resolved, sr.Path+"/") {
+				ldpath = resolved
+			}
+			ldpath = ldpath[len(sr.Path):]
+
+			libpath := []string{}
+			for _, d := range arch.LibPath(sr.Path) {
+				if info, err := os.Stat(d); err == nil && info.IsDir() {
+					libpath = append(libpath, d[len(sr.Path):])
 				}
-				ldpath = ldpath[len(sr.Path):]
-				// TODO: Save to the config
-				return ldpath, nil
 			}
+
+			if err := srm.cacheDynLinker(sr, ldpath, libpath); err != nil {
+				srm.GetLogger().Debugf("Unable to cache dynamic linker: %s", err.Error())
+			}
+			return ldpath, nil
 		}
 	}
 	return "", fmt.Errorf("ld.so was not found for the sysroot at %s", sr.Path)
@@ -0,0 +1,58 @@
+package sysmgr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMapSearchPath(t *testing.T) {
+	root, origin := "/usr/sysroots/test.aarch64", "/home/user/build/bin"
+	cases := []struct {
+		entry   string
+		mapped  []string
+		skipped []string
+	}{
+		{"/usr/lib/foo", []string{root + "/usr/lib/foo"}, []string{}},
+		{"$ORIGIN", []string{origin}, []string{}},
+		{"${ORIGIN}", []string{origin}, []string{}},
+		{"$ORIGIN/../lib", []string{"/home/user/build/lib"}, []string{}},
+		{"${ORIGIN}/../lib", []string{"/home/user/build/lib"}, []string{}},
+		{"/opt/x/${ORIGIN}/lib", []string{"/opt/x" + origin + "/lib"}, []string{}},
+		{"$ORIGINAL/lib", []string{}, []string{"$ORIGINAL/lib"}},
+		{"/usr/$LIB", []string{}, []string{"/usr/$LIB"}},
+		{"/usr/${PLATFORM}/lib", []string{}, []string{"/usr/${PLATFORM}/lib"}},
+		{"$ORIGIN/$LIB", []string{}, []string{"$ORIGIN/$LIB"}},
+		{"lib", []string{}, []string{"lib"}},
+	}
+
+	for _, c := range cases {
+		mapped, skipped := mapSearchPath(root, origin, []string{c.entry})
+		if !reflect.DeepEqual(mapped, c.mapped) || !reflect.DeepEqual(skipped, c.skipped) {
+			t.Errorf("%s: expected %v, %v, got %v, %v", c.entry, c.mapped, c.skipped, mapped, skipped)
+		}
+	}
+}
+
+func TestPopGlobalArgs(t *testing.T) {
+	cases := []struct {
+		args []string
+		id   string
+		wait bool
+		rest []string
+	}{
+		{[]string{"install", "foo", "--sysroot", "x.aarch64", "--no-wait"}, "", true, []string{"install", "foo", "--sysroot", "x.aarch64", "--no-wait"}},
+		{[]string{"-y", "--", "--sysroot", "x.aarch64"}, "", true, []string{"-y", "--", "--sysroot", "x.aarch64"}},
+		{[]string{"--sysroot=x.aarch64", "install", "foo"}, "x.aarch64", true, []string{"install", "foo"}},
+		{[]string{"--sysroot", "x.aarch64", "install", "foo"}, "x.aarch64", true, []string{"install", "foo"}},
+		{[]string{"-y", "--sysroot"}, "", true, []string{"-y"}},
+		{[]string{"--no-wait", "-y", "install", "foo"}, "", false, []string{"-y", "install", "foo"}},
+		{[]string{"run", "--", "./bin", "--no-wait"}, "", true, []string{"run", "--", "./bin", "--no-wait"}},
+	}
+
+	for _, c := range cases {
+		id, wait, rest := SysrootManager{}.popGlobalArgs(c.args)
+		if id != c.id || wait != c.wait || !reflect.DeepEqual(rest, c.rest) {
+			t.Errorf("%v: expected %q, %v, %q, got %q, %v, %q", c.args, c.id, c.wait, c.rest, id, wait, rest)
+		}
+	}
+}
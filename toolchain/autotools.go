@@ -0,0 +1,55 @@
+package sysmgr_toolchain
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Autotools returns a site configuration, suitable for CONFIG_SITE of the configure script.
+// Cache values are those, which cannot be detected while cross-compiling.
+func (tc *Toolchain) Autotools() string {
+	var buff strings.Builder
+	buff.WriteString(tc.header("#"))
+	buff.WriteString(fmt.Sprintf("# Usage: CONFIG_SITE=<this file> ./configure --host=%s\n\n", tc.triplet))
+
+	buff.WriteString(fmt.Sprintf("test -z \"$host_alias\" && host_alias=%s\n", tc.triplet))
+	if tc.hasCC {
+		buff.WriteString(fmt.Sprintf("test -z \"$CC\" && CC=%s-gcc\n", tc.triplet))
+		buff.WriteString(fmt.Sprintf("test -z \"$CXX\" && CXX=%s-g++\n", tc.triplet))
+	} else {
+		buff.WriteString(fmt.Sprintf("test -z \"$CC\" && CC=\"clang --target=%s\"\n", tc.triplet))
+		buff.WriteString(fmt.Sprintf("test -z \"$CXX\" && CXX=\"clang++ --target=%s\"\n", tc.triplet))
+	}
+	buff.WriteString(fmt.Sprintf("CPPFLAGS=\"--sysroot=%s $CPPFLAGS\"\n", tc.sysroot.Path))
+	buff.WriteString(fmt.Sprintf("LDFLAGS=\"--sysroot=%s $LDFLAGS\"\n", tc.sysroot.Path))
+	buff.WriteString(fmt.Sprintf("PKG_CONFIG_SYSROOT_DIR=%s\n", tc.sysroot.Path))
+	buff.WriteString(fmt.Sprintf("PKG_CONFIG_LIBDIR=%s\n", strings.Join(tc.PkgConfigDirs(), ":")))
+	buff.WriteString("export PKG_CONFIG_SYSROOT_DIR PKG_CONFIG_LIBDIR\n\n")
+
+	bigEndian, sizeofLong := "no", 4
+	if tc.arch.IsBigEndian() {
+		bigEndian = "yes"
+	}
+	if tc.arch.CPUBit == 64 {
+		sizeofLong = 8
+	}
+	for _, line := range [][]interface{}{
+		{"ac_cv_c_bigendian", bigEndian},
+		{"ac_cv_sizeof_char", 1},
+		{"ac_cv_sizeof_short", 2},
+		{"ac_cv_sizeof_int", 4},
+		{"ac_cv_sizeof_long", sizeofLong},
+		{"ac_cv_sizeof_long_long", 8},
+		{"ac_cv_sizeof_void_p", sizeofLong},
+		{"ac_cv_sizeof_size_t", sizeofLong},
+		{"ac_cv_func_malloc_0_nonnull", "yes"},
+		{"ac_cv_func_realloc_0_nonnull", "yes"},
+		{"ac_cv_func_mmap_fixed_mapped", "yes"},
+		{"ac_cv_func_setpgrp_void", "yes"},
+		{"ac_cv_file__dev_zero", "yes"},
+	} {
+		buff.WriteString(fmt.Sprintf("%s=${%s=%v}\n", line[0], line[0], line[1]))
+	}
+
+	return buff.String()
+}
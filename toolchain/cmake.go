@@ -0,0 +1,45 @@
+package sysmgr_toolchain
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CMake returns a toolchain file, suitable for CMAKE_TOOLCHAIN_FILE
+func (tc *Toolchain) CMake() string {
+	var buff strings.Builder
+	buff.WriteString(tc.header("#"))
+
+	for _, line := range [][]string{
+		{"CMAKE_SYSTEM_NAME", "Linux"},
+		{"CMAKE_SYSTEM_PROCESSOR", tc.arch.Name},
+		{"CMAKE_SYSROOT", tc.sysroot.Path},
+		{"CMAKE_C_COMPILER_TARGET", tc.triplet},
+		{"CMAKE_CXX_COMPILER_TARGET", tc.triplet},
+	} {
+		buff.WriteString(fmt.Sprintf("set(%s \"%s\")\n", line[0], line[1]))
+	}
+
+	if tc.hasCC {
+		buff.WriteString(fmt.Sprintf("set(CMAKE_C_COMPILER \"%s-gcc\")\n", tc.triplet))
+		buff.WriteString(fmt.Sprintf("set(CMAKE_CXX_COMPILER \"%s-g++\")\n", tc.triplet))
+	}
+	buff.WriteString("\n")
+
+	// Programs are from the host, everything else only from the system root
+	buff.WriteString("set(CMAKE_FIND_ROOT_PATH \"${CMAKE_SYSROOT}\")\n")
+	for _, line := range [][]string{
+		{"PROGRAM", "NEVER"},
+		{"LIBRARY", "ONLY"},
+		{"INCLUDE", "ONLY"},
+		{"PACKAGE", "ONLY"},
+	} {
+		buff.WriteString(fmt.Sprintf("set(CMAKE_FIND_ROOT_PATH_MODE_%s %s)\n", line[0], line[1]))
+	}
+
+	if tc.qemu != "" {
+		buff.WriteString(fmt.Sprintf("\nset(CMAKE_CROSSCOMPILING_EMULATOR \"%s;-L;%s\")\n", tc.qemu, tc.sysroot.Path))
+	}
+
+	return buff.String()
+}
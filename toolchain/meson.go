@@ -0,0 +1,46 @@
+package sysmgr_toolchain
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Meson returns a cross file, suitable for "meson setup --cross-file"
+func (tc *Toolchain) Meson() string {
+	var buff strings.Builder
+	buff.WriteString(tc.header("#"))
+
+	buff.WriteString("[binaries]\n")
+	if tc.hasCC {
+		for _, line := range [][]string{{"c", "gcc"}, {"cpp", "g++"}, {"ar", "ar"}, {"strip", "strip"}} {
+			buff.WriteString(fmt.Sprintf("%s = '%s-%s'\n", line[0], tc.triplet, line[1]))
+		}
+	} else {
+		buff.WriteString(fmt.Sprintf("c = ['clang', '--target=%s']\n", tc.triplet))
+		buff.WriteString(fmt.Sprintf("cpp = ['clang++', '--target=%s']\n", tc.triplet))
+		buff.WriteString("ar = 'llvm-ar'\nstrip = 'llvm-strip'\n")
+	}
+	buff.WriteString("pkg-config = 'pkg-config'\n")
+	if tc.qemu != "" {
+		buff.WriteString(fmt.Sprintf("exe_wrapper = ['%s', '-L', '%s']\n", tc.qemu, tc.sysroot.Path))
+	}
+
+	buff.WriteString("\n[host_machine]\n")
+	buff.WriteString("system = 'linux'\n")
+	buff.WriteString(fmt.Sprintf("cpu_family = '%s'\n", tc.arch.Family))
+	buff.WriteString(fmt.Sprintf("cpu = '%s'\n", tc.arch.Name))
+	buff.WriteString(fmt.Sprintf("endian = '%s'\n", tc.endian()))
+
+	// Meson does not pass sys_root to the compiler
+	buff.WriteString("\n[built-in options]\n")
+	for _, opt := range []string{"c_args", "cpp_args", "c_link_args", "cpp_link_args"} {
+		buff.WriteString(fmt.Sprintf("%s = ['--sysroot=%s']\n", opt, tc.sysroot.Path))
+	}
+
+	buff.WriteString("\n[properties]\n")
+	buff.WriteString(fmt.Sprintf("sys_root = '%s'\n", tc.sysroot.Path))
+	buff.WriteString(fmt.Sprintf("pkg_config_libdir = '%s'\n", strings.Join(tc.PkgConfigDirs(), ":")))
+	buff.WriteString("needs_exe_wrapper = true\n")
+
+	return buff.String()
+}
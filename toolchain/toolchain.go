@@ -0,0 +1,108 @@
+package sysmgr_toolchain
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+
+	sysmgr_arch "github.com/infra-whizz/sys-mgr/arch"
+	sysmgr_lib "github.com/infra-whizz/sys-mgr/lib"
+	sysmgr_sr "github.com/infra-whizz/sys-mgr/sr"
+	wzlib_logger "github.com/infra-whizz/wzlib/logger"
+)
+
+// Toolchain describes a cross-compilation setup for a system root
+type Toolchain struct {
+	sysroot *sysmgr_sr.SysRoot
+	arch    *sysmgr_arch.Arch
+	triplet string
+	hasCC   bool
+	qemu    string
+
+	wzlib_logger.WzLogger
+}
+
+// NewToolchain constructor
+func NewToolchain(sysroot *sysmgr_sr.SysRoot, arch *sysmgr_arch.Arch) *Toolchain {
+	tc := new(Toolchain)
+	tc.sysroot = sysroot
+	tc.arch = arch
+
+	// Cross compiler is optional, as e.g. clang needs only a target triplet
+	for _, triplet := range arch.Triplets {
+		if _, err := exec.LookPath(triplet + "-gcc"); err == nil {
+			tc.triplet, tc.hasCC = triplet, true
+			break
+		}
+	}
+	if tc.triplet == "" && len(arch.Triplets) > 0 {
+		tc.triplet = arch.Triplets[0]
+		tc.GetLogger().Warnf("No cross compiler found for %s architecture, assuming %s", arch.Name, tc.triplet)
+	}
+
+	var err error
+	if tc.qemu, err = sysmgr_lib.FindQemu(arch.Qemu, false); err != nil {
+		tc.GetLogger().Warnf("%s, emulator will not be set", err.Error())
+	}
+
+	return tc
+}
+
+// Generate a toolchain file for the build system by its name
+func (tc *Toolchain) Generate(kind string) (string, error) {
+	switch kind {
+	case "cmake":
+		return tc.CMake(), nil
+	case "meson":
+		return tc.Meson(), nil
+	case "autotools":
+		return tc.Autotools(), nil
+	default:
+		return "", fmt.Errorf("Unknown toolchain type: %s", kind)
+	}
+}
+
+// header returns comment lines about the origin of the generated file
+func (tc *Toolchain) header(comment string) string {
+	return fmt.Sprintf("%s Cross-compilation setup for the system root \"%s\" (%s)\n%s Generated by sysroot-manager\n\n",
+		comment, tc.sysroot.Name, tc.sysroot.Arch, comment)
+}
+
+// PkgConfigDirs returns directories with .pc files of the system root
+func (tc *Toolchain) PkgConfigDirs() []string {
+	return PkgConfigDirs(tc.sysroot, tc.arch)
+}
+
+// PkgConfigDirs returns directories with .pc files of the system root, multiarch ones first
+func PkgConfigDirs(sysroot *sysmgr_sr.SysRoot, arch *sysmgr_arch.Arch) []string {
+	dirs := []string{}
+	if arch.Multiarch != "" {
+		dirs = append(dirs, path.Join("/usr/lib", arch.Multiarch, "pkgconfig"))
+	}
+	for _, triplet := range arch.Triplets {
+		if triplet != arch.Multiarch {
+			dirs = append(dirs, path.Join("/usr/lib", triplet, "pkgconfig"))
+		}
+	}
+	if arch.CPUBit == 64 {
+		dirs = append(dirs, "/usr/lib64/pkgconfig")
+	}
+	dirs = append(dirs, "/usr/lib/pkgconfig", "/usr/share/pkgconfig")
+
+	found := []string{}
+	for _, d := range dirs {
+		if info, err := os.Stat(path.Join(sysroot.Path, d)); err == nil && info.IsDir() {
+			found = append(found, path.Join(sysroot.Path, d))
+		}
+	}
+	return found
+}
+
+// endian returns byte order of the target
+func (tc *Toolchain) endian() string {
+	if tc.arch.IsBigEndian() {
+		return "big"
+	}
+	return "little"
+}